@@ -9,6 +9,12 @@ export function fetchLogin<T>(username: string, password: string) {
   })
 }
 
+export function fetchLogout<T>() {
+  return post<T>({
+    url: "/logout",
+  })
+}
+
 export function fetchRepos<T>() {
   return post<T>({
     url: "/repos",
@@ -16,22 +22,38 @@ export function fetchRepos<T>() {
 }
 
 export interface CommitsReq {
-  id: number,
+  id: string,
   pager: {
     index?: number,
     size?: number
-  }
+  },
+  // next of the previous page, index is ignored when set
+  cursor?: string,
+  // filters, dates are YYYY-MM-DD
+  from?: string,
+  to?: string,
+  author?: string,
+  message?: string,
+  path?: string
 }
 export interface CommitsRes {
+  // -1 when filtered
   total: number,
-  list: Commit[]
+  list: Commit[],
+  next?: string
 }
 export interface Commit {
     hash: string,
     message: string,
     author: string,
     date: string,
-    email: string
+    email: string,
+    // only in the commit list
+    stats?: {
+      files: number,
+      added: number,
+      removed: number
+    }
 }
 
 export function fetchCommits(data: CommitsReq): Promise<CommitsRes> {
@@ -42,25 +64,43 @@ export function fetchCommits(data: CommitsReq): Promise<CommitsRes> {
 }
 
 export interface RevertReq {
-  id: number,
+  id: string,
   hash: string,
-  file: string[]
+  file: string[],
+  // target, over the current files when unset
+  dir?: string,
+  suffix?: boolean,
+  commit?: boolean
 }
 
-export function fetchRevert(data: RevertReq): Promise<any> {
-  return post<CommitsRes>({
+export interface RestoreResult {
+  file: string,
+  path?: string,
+  error?: string
+}
+
+export function fetchRevert(data: RevertReq): Promise<RestoreResult[]> {
+  return post<RestoreResult[]>({
     url: "/revert",
     data
   })
 }
 
+
 export interface ChangesReq {
-  id: number,
+  id: string,
   hash: string
 }
 export interface ChangesRes {
+    // A M D, R renamed, C copied
     action: string,
-    name: string
+    name: string,
+    // source of R and C
+    oldName?: string,
+    added: number,
+    removed: number,
+    binary: boolean,
+    sizeDelta: number
 }
 
 export function fetchChanges(data: ChangesReq): Promise<ChangesRes[]> {
@@ -68,4 +108,167 @@ export function fetchChanges(data: ChangesReq): Promise<ChangesRes[]> {
     url: "/changes",
     data
   })
-}
\ No newline at end of file
+}
+
+export interface DeletedReq {
+  id: string,
+  // dates are YYYY-MM-DD
+  from?: string,
+  to?: string
+}
+
+export interface DeletedFile {
+  path: string,
+  size: number,
+  // last commit the file existed in
+  commit: Commit,
+  deletedBy: Commit
+}
+
+export function fetchDeleted(data: DeletedReq): Promise<DeletedFile[]> {
+  return post<DeletedFile[]>({
+    url: "/deleted",
+    data
+  })
+}
+
+export interface RestoreDeletedReq {
+  id: string,
+  path: string[],
+  dir?: string,
+  suffix?: boolean,
+  commit?: boolean
+}
+
+export function fetchRestoreDeleted(data: RestoreDeletedReq): Promise<RestoreResult[]> {
+  return post<RestoreResult[]>({
+    url: "/deleted/restore",
+    data
+  })
+}
+
+export interface TreeReq {
+  id: string,
+  hash?: string,
+  path?: string
+}
+
+export interface TreeEntry {
+  name: string,
+  path: string,
+  type: 'dir' | 'file' | 'symlink' | 'submodule',
+  mode: string,
+  size: number,
+  commit: Commit | null
+}
+
+export interface TreeRes {
+  hash: string,
+  path: string,
+  entries: TreeEntry[]
+}
+
+export function fetchTree(data: TreeReq): Promise<TreeRes> {
+  return post<TreeRes>({
+    url: "/tree",
+    data
+  })
+}
+
+export interface ArchiveReq {
+  id: string,
+  hash?: string,
+  format: 'zip' | 'tar.gz',
+  path?: string[]
+}
+
+// archiveUrl is downloaded by the browser, so it is a GET with the cookie
+export function archiveUrl(data: ArchiveReq): string {
+  const params = new URLSearchParams({ id: data.id, format: data.format })
+  if (data.hash) {
+    params.set('hash', data.hash)
+  }
+  for (const p of data.path ?? []) {
+    params.append('path', p)
+  }
+  return `${import.meta.env.VITE_GLOB_API_PREFIX.replace(/^\//, '')}/archive?${params}`
+}
+
+export interface Token {
+  id: string,
+  name: string,
+  scopes: string[],
+  created: string,
+  expires: string | null,
+  lastUsed: string | null
+}
+
+export function fetchTokens(): Promise<Token[]> {
+  return post<Token[]>({
+    url: "/tokens",
+  })
+}
+
+export interface CreateTokenReq {
+  name: string,
+  scopes: string[],
+  expires: number
+}
+
+export function fetchCreateToken(data: CreateTokenReq): Promise<{ info: Token, token: string }> {
+  return post({
+    url: "/tokens/create",
+    data
+  })
+}
+
+export function fetchRevokeToken(id: string): Promise<any> {
+  return post({
+    url: "/tokens/revoke",
+    data: { id }
+  })
+}
+export interface Repo {
+  id: string,
+  name: string,
+  path: string,
+  url: string,
+  branch: string,
+  username: string,
+  email: string,
+  debounce: number | null,
+  backend: string
+}
+
+export interface RepoReq {
+  id?: string,
+  name: string,
+  path: string,
+  url: string,
+  branch: string,
+  username: string,
+  password: string,
+  email: string,
+  debounce: number | null
+}
+
+export function fetchCreateRepo(data: RepoReq): Promise<{ restart: string[] | null }> {
+  return post({
+    url: "/repos/create",
+    data
+  })
+}
+
+export function fetchUpdateRepo(data: RepoReq & { id: string }): Promise<{ restart: string[] | null }> {
+  return post({
+    url: "/repos/update",
+    data
+  })
+}
+
+export function fetchDeleteRepo(id: string): Promise<{ restart: string[] | null }> {
+  return post({
+    url: "/repos/delete",
+    data: { id }
+  })
+}
@@ -22,8 +22,11 @@ const routes: RouteRecordRaw[] = [
   },
 ]
 
+// 服务端在 index.html 中注入 <base href>，用于挂载在反向代理子路径下
+const base = document.querySelector('base')?.getAttribute('href') ?? '/'
+
 export const router = createRouter({
-  history: createWebHistory(),
+  history: createWebHistory(base),
   routes,
   scrollBehavior: () => ({ left: 0, top: 0 }),
 })
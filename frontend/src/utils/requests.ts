@@ -19,7 +19,8 @@ export interface Response<T = any> {
 }
 
 const request = axios.create({
-  baseURL: import.meta.env.VITE_GLOB_API_PREFIX,
+  // 相对于 <base> 请求，兼容反向代理子路径
+  baseURL: import.meta.env.VITE_GLOB_API_PREFIX.replace(/^\//, ''),
 })
 
 request.interceptors.request.use(
@@ -0,0 +1,11 @@
+import type { RestoreResult } from '@/api'
+
+// reportRestore shows the files that failed, or success when there are none
+export function reportRestore(res: RestoreResult[], success: string) {
+  const failed = res.filter(r => r.error)
+  if (failed.length === 0) {
+    window.$message?.success(success)
+    return
+  }
+  window.$message?.error(`${failed.length} 个文件恢复失败：` + failed.map(r => `${r.file}: ${r.error}`).join('；'))
+}
@@ -11,6 +11,8 @@ import { defineConfig, loadEnv } from 'vite'
 export default defineConfig((env) => {
   const viteEnv = loadEnv(env.mode, process.cwd()) as unknown as ImportMetaEnv
   return {
+    // 使用相对路径，服务端通过 <base> 指定挂载的子路径
+    base: './',
     resolve: {
       alias: {
         '@': path.resolve(process.cwd(), 'src'),
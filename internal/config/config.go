@@ -2,47 +2,97 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/charghet/go-sync/pkg/logger"
-	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Server   ServerConfig `yaml:"server"`
 	User     UserConfig   `yaml:"user"`
+	Auth     AuthConfig   `yaml:"auth"`
 	Repos    []RepoConfig `yaml:"repos"`
 	Ignore   *int         `yaml:"ignore"`
 	Pull     *bool        `yaml:"pull"`
 	Debounce *int         `yaml:"debounce" json:"debounce"`
+	// 退出时等待提交和推送完成的最长时间 秒
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
 }
 
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host       string    `yaml:"host"`
+	Port       int       `yaml:"port"`
+	TokenStore string    `yaml:"token_store"` // api token 哈希存储文件
+	Tls        TlsConfig `yaml:"tls"`
+	BasePath   string    `yaml:"base_path"`   // 反向代理子路径 如 /go-sync
+	Socket     string    `yaml:"socket"`      // 非空时监听 unix socket 而不是 host:port
+	SocketMode string    `yaml:"socket_mode"` // unix socket 文件权限 如 0660
+}
+
+type TlsConfig struct {
+	Enable       bool   `yaml:"enable"`
+	Cert         string `yaml:"cert"`
+	Key          string `yaml:"key"`
+	SelfSigned   bool   `yaml:"self_signed"`   // 证书不存在时自动生成自签名证书
+	RedirectPort int    `yaml:"redirect_port"` // 非0时在该端口监听http并跳转到https
 }
 
 type UserConfig struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"` // 从文件读取密码
+}
+
+type AuthConfig struct {
+	Proxy ProxyAuthConfig `yaml:"proxy"`
+}
+
+// ProxyAuthConfig 信任反向代理(oauth2-proxy/Authelia 等)传入的用户名
+type ProxyAuthConfig struct {
+	Enable       bool              `yaml:"enable"`
+	Header       string            `yaml:"header"`        // 默认 X-Forwarded-User
+	Trusted      []string          `yaml:"trusted"`       // 可信代理 CIDR，unix 表示 unix socket
+	Users        map[string]string `yaml:"users"`         // 用户名 -> 角色 read/write/admin
+	DefaultRole  string            `yaml:"default_role"`  // 未在 users 中的用户角色，为空时拒绝
+	DisableLogin bool              `yaml:"disable_login"` // 禁用密码登录
 }
 
 type RepoConfig struct {
+	Id       string `yaml:"id" json:"id"` // 稳定的仓库标识，默认与 name 相同
 	Name     string `yaml:"name" json:"name"`
 	Path     string `yaml:"path" json:"path"` // 本地路径
 	Url      string `yaml:"url" json:"url"`
 	Branch   string `yaml:"branch" json:"branch"`
 	Username string `yaml:"username" json:"username"`
 	Password string `yaml:"password" json:"password"`
-	Email    string `yaml:"email" json:"email"`
-	Ignore   *int   `yaml:"ignore"`
-	Pull     *bool  `yaml:"pull"`
-	Debounce *int   `yaml:"debounce" json:"debounce"` // 防抖时间 秒
+	// 从文件读取密码或 token，如 docker/systemd secrets
+	PasswordFile string `yaml:"password_file" json:"-"`
+	TokenFile    string `yaml:"token_file" json:"-"`
+	Email        string `yaml:"email" json:"email"`
+	Ignore       *int   `yaml:"ignore"`
+	Pull         *bool  `yaml:"pull"`
+	Debounce     *int   `yaml:"debounce" json:"debounce"` // 防抖时间 秒
+	// git 操作的实现 go-git(内置) 或 git(调用系统的 git 命令)
+	Backend string `yaml:"backend" json:"backend"`
 }
 
+const (
+	BackendGoGit = "go-git"
+	BackendGit   = "git"
+)
+
 var path = "config.yaml"
-var config *Config
+
+// config 只会被整体替换，不会修改已读取的 Config
+var config atomic.Pointer[Config]
+var initMu sync.Mutex
 
 func SetDefaultConfig(con *Config) {
 	if con.Ignore == nil {
@@ -50,12 +100,38 @@ func SetDefaultConfig(con *Config) {
 		con.Ignore = &i
 	}
 
+	if con.ShutdownTimeout == 0 {
+		con.ShutdownTimeout = 30
+	}
+
 	if con.Server.Host == "" {
 		con.Server.Host = "127.0.0.1"
 	}
 	if con.Server.Port == 0 {
 		con.Server.Port = 2222
 	}
+	if con.Server.TokenStore == "" {
+		con.Server.TokenStore = "tokens.json"
+	}
+	if con.Auth.Proxy.Header == "" {
+		con.Auth.Proxy.Header = "X-Forwarded-User"
+	}
+
+	con.Server.BasePath = strings.TrimRight(con.Server.BasePath, "/")
+	if con.Server.BasePath != "" && !strings.HasPrefix(con.Server.BasePath, "/") {
+		con.Server.BasePath = "/" + con.Server.BasePath
+	}
+	if con.Server.SocketMode == "" {
+		con.Server.SocketMode = "0660"
+	}
+	if con.Server.Tls.Enable {
+		if con.Server.Tls.Cert == "" {
+			con.Server.Tls.Cert = "cert.pem"
+		}
+		if con.Server.Tls.Key == "" {
+			con.Server.Tls.Key = "key.pem"
+		}
+	}
 
 	if con.User.Username == "" {
 		con.User.Username = "admin"
@@ -69,12 +145,18 @@ func SetDefaultConfig(con *Config) {
 		if r.Name == "" {
 			r.Name = r.Path
 		}
+		if r.Id == "" {
+			r.Id = r.Name
+		}
 		if r.Branch == "" {
 			r.Branch = "master"
 		}
 		if r.Email == "" {
 			r.Email = "go-sync@example.com"
 		}
+		if r.Backend == "" {
+			r.Backend = BackendGoGit
+		}
 
 		if r.Ignore == nil {
 			if con.Ignore == nil {
@@ -106,49 +188,139 @@ func SetDefaultConfig(con *Config) {
 }
 
 func toInit() {
-	if config != nil {
+	if config.Load() != nil {
 		return
 	}
-	config = &Config{}
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0666)
-	if err != nil {
-		logger.Fatal("Failed to read config file:", err)
+	initMu.Lock()
+	defer initMu.Unlock()
+	if config.Load() != nil {
+		return
 	}
-	decoder := yaml.NewDecoder(file)
-	err = decoder.Decode(config)
-	if err != nil {
-		logger.Fatal("Failed to decode config:", err)
+	con, err := Load(path)
+	if os.IsNotExist(err) {
+		logger.Warn("Config file not found:", path, "run `go-sync init` to create one.")
+		con = &Config{}
+		SetDefaultConfig(con)
+	} else if err != nil {
+		var verr ValidationError
+		if !errors.As(err, &verr) {
+			logger.Fatal("Failed to read config file:", err)
+		}
+		for _, p := range verr {
+			logger.Danger(fmt.Sprintf("[%v]", path), p.String())
+		}
+		logger.Fatal(fmt.Sprintf("Invalid config file %s, run `go-sync doctor` for details.", path))
 	}
+	config.Store(con)
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		logger.Warn("Failed to get absolute path of config file:", err)
 	}
 	logger.Info("loaded config:", abs)
 
-	SetDefaultConfig(config)
-	b, _ := json.Marshal(config)
+	b, _ := json.Marshal(con.Redacted())
 	logger.Debug("config:", string(b))
 }
 
-func GetConfig() *Config {
+// Load reads and validates the config file at p, see Parse.
+func Load(p string) (*Config, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// GetConfig returns a copy of the running config. Reload replaces the
+// config as a whole, so read it again instead of keeping it.
+func GetConfig() Config {
 	toInit()
-	return config
+	return *config.Load()
+}
+
+func Path() string {
+	return path
 }
 
-func SetPath(p string) *Config {
+func SetPath(p string) Config {
 	path = p
-	toInit()
-	return config
+	return GetConfig()
+}
+
+// RepoIndex returns the position of the repository with id in the config, or -1.
+func RepoIndex(id string) int {
+	for i, r := range GetConfig().Repos {
+		if r.Id == id {
+			return i
+		}
+	}
+	return -1
 }
 
 func RepoInfo() []RepoConfig {
-	res := make([]RepoConfig, len(config.Repos))
-	for i, repo := range config.Repos {
+	repos := GetConfig().Repos
+	res := make([]RepoConfig, len(repos))
+	for i, repo := range repos {
 		res[i] = RepoConfig{
-			Name:   repo.Name,
-			Path:   repo.Path,
-			Url:    repo.Url,
-			Branch: repo.Branch,
+			Id:       repo.Id,
+			Name:     repo.Name,
+			Path:     repo.Path,
+			Url:      repo.Url,
+			Branch:   repo.Branch,
+			Username: repo.Username,
+			Email:    repo.Email,
+			Debounce: repo.Debounce,
+			Backend:  repo.Backend,
+		}
+	}
+	return res
+}
+
+// Update validates b and replaces the config file with it. The running
+// config is not changed.
+func Update(b []byte) error {
+	_, err := Parse(b)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// Reload reads the config file again and replaces the running config, which
+// GetConfig returns from then on. An invalid file is rejected and the
+// running config is kept. It returns the changed settings that only take
+// effect after a restart.
+func Reload() ([]string, error) {
+	toInit()
+	con, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	old := config.Swap(con)
+	return restartOnly(old, con), nil
+}
+
+func restartOnly(old, con *Config) []string {
+	res := diffFields("server", reflect.ValueOf(old.Server), reflect.ValueOf(con.Server))
+	res = append(res, diffFields("auth.proxy", reflect.ValueOf(old.Auth.Proxy), reflect.ValueOf(con.Auth.Proxy))...)
+	if old.ShutdownTimeout != con.ShutdownTimeout {
+		res = append(res, "shutdown_timeout")
+	}
+	return res
+}
+
+// diffFields lists the yaml keys of the fields that differ between a and b.
+func diffFields(prefix string, a, b reflect.Value) []string {
+	var res []string
+	for i := 0; i < a.NumField(); i++ {
+		if reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			continue
+		}
+		name := prefix + "." + a.Type().Field(i).Tag.Get("yaml")
+		if a.Field(i).Kind() == reflect.Struct {
+			res = append(res, diffFields(name, a.Field(i), b.Field(i))...)
+		} else {
+			res = append(res, name)
 		}
 	}
 	return res
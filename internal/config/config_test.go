@@ -5,13 +5,15 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func createTestConfig(p string) {
 	s := `repos:
  - path: /go-sync
    url: https://github.com/charghet/go-sync.git
-	 username: user
+   username: user
    password: 123456
    email: user@example.com`
 	_, err := os.Stat(filepath.Dir(p))
@@ -32,8 +34,8 @@ func TestGetConfig(t *testing.T) {
 	createTestConfig(p)
 	SetPath(p)
 	config := GetConfig()
-	if config == nil {
-		t.Error("Expected config to be loaded, but got nil")
+	if config.Ignore == nil {
+		t.Error("Expected config to be loaded with defaults, but Ignore is nil")
 		return
 	}
 	b, err := json.Marshal(config)
@@ -45,3 +47,60 @@ func TestGetConfig(t *testing.T) {
 		t.Error("Expected at least one repo in config, but got none")
 	}
 }
+
+func TestRender(t *testing.T) {
+	con := &Config{}
+	con.User.Username = "admin"
+	con.User.Password = "p: #1"
+	con.Repos = []RepoConfig{{Name: "notes", Path: "/data/notes", Url: "https://example.com/notes.git", Branch: "main"}}
+	b, err := Render(con)
+	if err != nil {
+		t.Fatalf("Failed to render config: %v", err)
+	}
+	var res Config
+	err = yaml.Unmarshal(b, &res)
+	if err != nil {
+		t.Fatalf("Failed to parse rendered config: %v\n%s", err, b)
+	}
+	if res.User.Password != con.User.Password || len(res.Repos) != 1 || res.Repos[0].Url != con.Repos[0].Url {
+		t.Errorf("Rendered config does not match: %+v", res)
+	}
+}
+
+func TestRestartOnly(t *testing.T) {
+	old := &Config{}
+	SetDefaultConfig(old)
+	con := &Config{}
+	SetDefaultConfig(con)
+	con.Server.Port = 3333
+	con.Server.Tls.Enable = true
+	con.User.Password = "changed"
+	res := restartOnly(old, con)
+	if len(res) != 2 || res[0] != "server.port" || res[1] != "server.tls.enable" {
+		t.Errorf("Expected server.port and server.tls.enable, got %v", res)
+	}
+}
+
+func TestReloadConcurrent(t *testing.T) {
+	p := "../../test/config/config.yaml"
+	createTestConfig(p)
+	SetPath(p)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = GetConfig().User.Username
+			_ = RepoInfo()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if len(GetConfig().Repos) != 1 {
+		t.Errorf("Repos = %v", GetConfig().Repos)
+	}
+}
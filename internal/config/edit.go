@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AddRepo appends rc to the repos of the config file. Like SetRepo and
+// RemoveRepo it edits the yaml tree so comments are kept, and returns the
+// new file content together with the config parsed from it. The file itself
+// is not written, see Update.
+func AddRepo(rc RepoConfig) ([]byte, *Config, error) {
+	return editRepos(func(seq *yaml.Node) error {
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		setRepo(n, rc)
+		seq.Content = append(seq.Content, n)
+		return nil
+	})
+}
+
+// SetRepo replaces the settings of the i-th repository. An empty password
+// keeps the current password or password file, nil debounce, ignore and pull
+// keep their current values.
+func SetRepo(i int, rc RepoConfig) ([]byte, *Config, error) {
+	return editRepos(func(seq *yaml.Node) error {
+		if i < 0 || i >= len(seq.Content) || seq.Content[i].Kind != yaml.MappingNode {
+			return fmt.Errorf("repository %d not found", i+1)
+		}
+		setRepo(seq.Content[i], rc)
+		return nil
+	})
+}
+
+// RemoveRepo removes the i-th repository, its files are left on disk.
+func RemoveRepo(i int) ([]byte, *Config, error) {
+	return editRepos(func(seq *yaml.Node) error {
+		if i < 0 || i >= len(seq.Content) {
+			return fmt.Errorf("repository %d not found", i+1)
+		}
+		seq.Content = append(seq.Content[:i], seq.Content[i+1:]...)
+		return nil
+	})
+}
+
+func editRepos(edit func(seq *yaml.Node) error) ([]byte, *Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	var root yaml.Node
+	err = yaml.Unmarshal(b, &root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s is not a yaml mapping", path)
+	}
+	seq := mapValue(doc, "repos")
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		seq = &yaml.Node{Kind: yaml.SequenceNode}
+		setValue(doc, "repos", seq)
+	}
+	err = edit(seq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&root)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoder.Close()
+	con, err := Parse(buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), con, nil
+}
+
+func setRepo(n *yaml.Node, rc RepoConfig) {
+	// id 一旦确定就不再修改，没有写 id 的仓库先写入当前由名字得到的 id，改名后不变
+	if mapValue(n, "id") == nil {
+		id := rc.Id
+		if id == "" {
+			id = nodeId(n)
+		}
+		if id == "" {
+			id = rc.Name
+		}
+		if id == "" {
+			id = rc.Path
+		}
+		setString(n, "id", id)
+	}
+	setString(n, "name", rc.Name)
+	setString(n, "path", rc.Path)
+	setString(n, "url", rc.Url)
+	setString(n, "branch", rc.Branch)
+	setString(n, "username", rc.Username)
+	if rc.Password != "" {
+		setString(n, "password", rc.Password)
+		deleteKey(n, "password_file")
+		deleteKey(n, "token_file")
+	}
+	setString(n, "email", rc.Email)
+	setInt(n, "debounce", rc.Debounce)
+	setInt(n, "ignore", rc.Ignore)
+	if rc.Pull != nil {
+		setValue(n, "pull", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(*rc.Pull)})
+	}
+}
+
+// nodeId returns the id a repository without id gets from its name or path,
+// see SetDefaultConfig.
+func nodeId(n *yaml.Node) string {
+	for _, key := range []string{"name", "path"} {
+		if v := mapValue(n, key); v != nil && v.Kind == yaml.ScalarNode && v.Value != "" {
+			return expandRefs(v.Value)
+		}
+	}
+	return ""
+}
+
+// setString sets key to s, an empty s removes the key so the default applies.
+func setString(n *yaml.Node, key, s string) {
+	if s == "" {
+		deleteKey(n, key)
+		return
+	}
+	// 值未变时保留 ${ENV} 引用
+	if old := mapValue(n, key); old != nil && old.Kind == yaml.ScalarNode && expandRefs(old.Value) == s {
+		return
+	}
+	setValue(n, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s})
+}
+
+func setInt(n *yaml.Node, key string, i *int) {
+	if i == nil {
+		return
+	}
+	setValue(n, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(*i)})
+}
+
+func mapValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setValue replaces the value of key and keeps the comments around it.
+func setValue(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			old := n.Content[i+1]
+			value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			n.Content[i+1] = value
+			return
+		}
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func deleteKey(n *yaml.Node, key string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return
+		}
+	}
+}
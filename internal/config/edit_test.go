@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditRepos(t *testing.T) {
+	con := &Config{}
+	con.User.Password = "secret"
+	con.Repos = []RepoConfig{{Name: "notes", Path: "/data/notes", Url: "https://example.com/notes.git", Password: "token"}}
+	b, err := Render(con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := path
+	path = filepath.Join(t.TempDir(), "config.yaml")
+	defer func() { path = old }()
+	err = os.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	debounce := 10
+	b, res, err := AddRepo(RepoConfig{Name: "photos", Path: "/data/photos", Url: "https://example.com/photos.git", Debounce: &debounce})
+	if err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	if len(res.Repos) != 2 || *res.Repos[1].Debounce != 10 {
+		t.Fatalf("Expected the new repo, got %+v", res.Repos)
+	}
+	if !strings.Contains(string(b), "# 本地路径") {
+		t.Errorf("Expected comments to be kept, got:\n%s", b)
+	}
+	err = os.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, res, err = SetRepo(0, RepoConfig{Name: "notes", Path: "/data/notes", Url: "https://example.com/other.git"})
+	if err != nil {
+		t.Fatalf("Failed to update repo: %v", err)
+	}
+	if res.Repos[0].Url != "https://example.com/other.git" || res.Repos[0].Password != "token" {
+		t.Errorf("Expected the url to change and the password to be kept, got %+v", res.Repos[0])
+	}
+
+	_, _, err = AddRepo(RepoConfig{Name: "notes", Path: "/data/notes/inner"})
+	if err == nil {
+		t.Error("Expected a duplicate repo to be rejected")
+	}
+
+	_, res, err = RemoveRepo(0)
+	if err != nil {
+		t.Fatalf("Failed to remove repo: %v", err)
+	}
+	if len(res.Repos) != 1 || res.Repos[0].Name != "photos" {
+		t.Errorf("Expected only photos to be left, got %+v", res.Repos)
+	}
+}
+
+func TestSetRepoKeepsId(t *testing.T) {
+	old := path
+	path = filepath.Join(t.TempDir(), "config.yaml")
+	defer func() { path = old }()
+	err := os.WriteFile(path, []byte("repos:\n  - name: notes\n    path: /data/notes\n    url: https://example.com/notes.git\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, res, err := SetRepo(0, RepoConfig{Name: "diary", Path: "/data/notes", Url: "https://example.com/notes.git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Repos[0].Id != "notes" || res.Repos[0].Name != "diary" {
+		t.Errorf("Expected the id to be kept after a rename, got %+v", res.Repos[0])
+	}
+	err = os.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _, err = AddRepo(RepoConfig{Name: "photos", Path: "/data/photos", Url: "https://example.com/photos.git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "id: photos") {
+		t.Errorf("Expected the id of the added repo to be written, got:\n%s", b)
+	}
+	err = os.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, res, err = SetRepo(1, RepoConfig{Name: "pictures", Path: "/data/photos", Url: "https://example.com/photos.git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Repos[1].Id != "photos" {
+		t.Errorf("Expected the added repo to keep its id, got %+v", res.Repos[1])
+	}
+}
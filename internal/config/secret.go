@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} in every scalar value of n with the environment
+// variable NAME. A bare $ is kept as is so passwords containing $ still work.
+func (v *validator) expandEnv(n *yaml.Node, path []any) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			v.expandEnv(c, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.expandEnv(n.Content[i+1], append(path, n.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			v.expandEnv(c, append(path, i))
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return
+		}
+		n.Value = envRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			name := ref[2 : len(ref)-1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				v.add(fmt.Sprintf("environment variable %s is not set", name), path...)
+			}
+			return value
+		})
+		if n.Style == 0 {
+			// 重新推断类型，使 port: ${PORT} 可以解析为数字
+			n.Tag = ""
+		}
+	}
+}
+
+// expandRefs expands ${NAME} like expandEnv, unset variables are empty.
+func expandRefs(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// readSecrets fills the passwords from password_file and token_file, the
+// way docker and systemd pass secrets.
+func (v *validator) readSecrets(con *Config) {
+	if con.User.PasswordFile != "" {
+		if con.User.Password != "" {
+			v.add("password and password_file are both set", "user", "password_file")
+		}
+		con.User.Password = v.readSecret(con.User.PasswordFile, "user", "password_file")
+	}
+	for i := range con.Repos {
+		r := &con.Repos[i]
+		key, file := "password_file", r.PasswordFile
+		if r.TokenFile != "" {
+			if file != "" {
+				v.add("password_file and token_file are both set", "repos", i, "token_file")
+			}
+			key, file = "token_file", r.TokenFile
+		}
+		if file == "" {
+			continue
+		}
+		if r.Password != "" {
+			v.add("password and "+key+" are both set", "repos", i, key)
+		}
+		r.Password = v.readSecret(file, "repos", i, key)
+	}
+}
+
+func (v *validator) readSecret(p string, path ...any) string {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		v.add(err.Error(), path...)
+		return ""
+	}
+	return strings.TrimRight(string(b), "\r\n")
+}
+
+const redacted = "******"
+
+// Redacted returns a copy of con without passwords, for logging.
+func (con *Config) Redacted() *Config {
+	res := *con
+	if res.User.Password != "" {
+		res.User.Password = redacted
+	}
+	res.Repos = make([]RepoConfig, len(con.Repos))
+	for i, r := range con.Repos {
+		if r.Password != "" {
+			r.Password = redacted
+		}
+		res.Repos[i] = r
+	}
+	return &res
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/charghet/go-sync/pkg/util"
+	"gopkg.in/yaml.v3"
+)
+
+var newConfigTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"q": quote,
+}).Parse(`# go-sync 配置文件，由 go-sync init 生成
+# 以下全局配置可在每个仓库中单独覆盖
+
+# 启动时先拉取远程仓库
+pull: {{.Pull}}
+# 恢复文件后忽略文件变化的时间 秒
+ignore: {{.Ignore}}
+# 文件变化后等待多久再提交 秒
+debounce: {{.Debounce}}
+# 退出时等待提交和推送完成的最长时间 秒
+shutdown_timeout: {{.Shutdown}}
+
+# 网页界面
+server:
+  host: {{q .Server.Host}}
+  port: {{.Server.Port}}
+  # 反向代理子路径 如 /go-sync
+  # base_path: /go-sync
+  # tls:
+  #   enable: true
+  #   cert: cert.pem
+  #   key: key.pem
+  #   self_signed: true
+
+# 网页界面登录账户
+# 密码可以写成 ${ENV_VAR} 从环境变量读取，或用 password_file 从文件读取
+user:
+  username: {{q .User.Username}}
+  password: {{q .User.Password}}
+
+# 同步的仓库
+repos:
+{{- range .Repos}}
+  - name: {{q .Name}}
+    # 本地路径
+    path: {{q .Path}}
+    # 远程仓库地址
+    url: {{q .Url}}
+    branch: {{q .Branch}}
+    # 远程仓库账户，token 也填写在 password 中
+    # 也可以用 password_file 或 token_file 从文件读取，如 /run/secrets/token
+    username: {{q .Username}}
+    password: {{q .Password}}
+    # 提交时使用的邮箱
+    email: {{q .Email}}
+    # git 操作的实现，go-git(内置) 或 git(调用系统的 git 命令，支持 LFS、凭据助手等)
+    # backend: go-git
+{{- end}}
+`))
+
+type templateData struct {
+	*Config
+	Pull     bool
+	Ignore   int
+	Debounce int
+	Shutdown int
+}
+
+// Render writes a commented config file for con.
+func Render(con *Config) ([]byte, error) {
+	data := templateData{Config: con, Pull: true, Ignore: 3, Debounce: 3, Shutdown: 30}
+	if con.Pull != nil {
+		data.Pull = *con.Pull
+	}
+	if con.Ignore != nil {
+		data.Ignore = *con.Ignore
+	}
+	if con.Debounce != nil {
+		data.Debounce = *con.Debounce
+	}
+	if con.ShutdownTimeout != 0 {
+		data.Shutdown = con.ShutdownTimeout
+	}
+	var buf bytes.Buffer
+	err := newConfigTemplate.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write renders con to p, the file is only readable by the owner since it
+// contains passwords.
+func Write(p string, con *Config) error {
+	b, err := Render(con)
+	if err != nil {
+		return err
+	}
+	err = util.MkdirForFile(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0600)
+}
+
+func quote(s string) string {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return `""`
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
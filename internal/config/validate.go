@@ -0,0 +1,300 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a single mistake in the config file.
+type Problem struct {
+	Line    int    `json:"line"` // 0 表示无法定位
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Field != "" {
+		s = p.Field + ": " + s
+	}
+	if p.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", p.Line, s)
+	}
+	return s
+}
+
+// ValidationError lists every problem found in a config file.
+type ValidationError []Problem
+
+func (e ValidationError) Error() string {
+	s := make([]string, len(e))
+	for i, p := range e {
+		s[i] = p.String()
+	}
+	return strings.Join(s, "\n")
+}
+
+var roles = []string{"read", "write", "admin"}
+
+// Parse decodes a config file strictly, expands ${ENV} references, reads
+// secret files, fills in the defaults and validates the result. When the yaml
+// itself is readable the config is returned even if it is invalid, the error
+// is then a ValidationError.
+func Parse(b []byte) (*Config, error) {
+	var root yaml.Node
+	err := yaml.Unmarshal(b, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	// 未知字段只能用 Decoder 检查，此时尚未展开环境变量，忽略类型错误
+	var problems ValidationError
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&Config{})
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, e := range typeErr.Errors {
+			if strings.Contains(e, " not found in type ") {
+				problems = append(problems, typeProblem(e))
+			}
+		}
+	} else if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	con := &Config{}
+	v := &validator{root: &root}
+	v.expandEnv(&root, nil)
+	if root.Kind != 0 {
+		err = root.Decode(con)
+		if errors.As(err, &typeErr) {
+			for _, e := range typeErr.Errors {
+				problems = append(problems, typeProblem(e))
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	v.readSecrets(con)
+
+	SetDefaultConfig(con)
+	v.validate(con)
+	problems = append(problems, v.problems...)
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+		return con, problems
+	}
+	return con, nil
+}
+
+var typeErrLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// typeProblem turns "line 3: field foo not found in type config.RepoConfig"
+// into a Problem.
+func typeProblem(e string) Problem {
+	m := typeErrLine.FindStringSubmatch(e)
+	if m == nil {
+		return Problem{Message: e}
+	}
+	line, _ := strconv.Atoi(m[1])
+	msg := m[2]
+	if f, ok := strings.CutPrefix(msg, "field "); ok {
+		if name, _, ok := strings.Cut(f, " not found"); ok {
+			msg = fmt.Sprintf("unknown key %q", name)
+		}
+	}
+	return Problem{Line: line, Message: msg}
+}
+
+type validator struct {
+	root     *yaml.Node
+	problems []Problem
+}
+
+// add reports a problem at the deepest node of path that exists in the file.
+func (v *validator) add(msg string, path ...any) {
+	v.problems = append(v.problems, Problem{Line: v.line(path...), Field: field(path), Message: msg})
+}
+
+func (v *validator) line(path ...any) int {
+	n := v.root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	line := n.Line
+	for _, p := range path {
+		var next *yaml.Node
+		switch key := p.(type) {
+		case string:
+			if n.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(n.Content); i += 2 {
+					if n.Content[i].Value == key {
+						next = n.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if n.Kind == yaml.SequenceNode && key < len(n.Content) {
+				next = n.Content[key]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+		line = n.Line
+	}
+	return line
+}
+
+func field(path []any) string {
+	var b strings.Builder
+	for _, p := range path {
+		switch key := p.(type) {
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(key)
+		case int:
+			fmt.Fprintf(&b, "[%d]", key)
+		}
+	}
+	return b.String()
+}
+
+func (v *validator) validate(con *Config) {
+	v.notNegative(con.Ignore, "ignore")
+	v.notNegative(con.Debounce, "debounce")
+	if con.ShutdownTimeout < 0 {
+		v.add("must not be negative", "shutdown_timeout")
+	}
+
+	if con.Server.Socket == "" && (con.Server.Port < 1 || con.Server.Port > 65535) {
+		v.add(fmt.Sprintf("%d is not a valid port", con.Server.Port), "server", "port")
+	}
+	if _, err := strconv.ParseUint(con.Server.SocketMode, 8, 32); err != nil {
+		v.add(fmt.Sprintf("%q is not an octal file mode like 0660", con.Server.SocketMode), "server", "socket_mode")
+	}
+	if con.Server.Tls.RedirectPort < 0 || con.Server.Tls.RedirectPort > 65535 {
+		v.add(fmt.Sprintf("%d is not a valid port", con.Server.Tls.RedirectPort), "server", "tls", "redirect_port")
+	}
+
+	v.validateProxy(con.Auth.Proxy)
+
+	ids := map[string]int{}
+	names := map[string]int{}
+	paths := map[string]int{}
+	for i, r := range con.Repos {
+		if r.Path == "" {
+			v.add("path is required", "repos", i)
+		} else {
+			p := absPath(r.Path)
+			if j, ok := paths[p]; ok {
+				v.add(fmt.Sprintf("path is already used by repos[%d]", j), "repos", i, "path")
+			} else {
+				paths[p] = i
+			}
+		}
+		if r.Url == "" {
+			v.add("url is required", "repos", i)
+		}
+		// 没有 id 时使用名字，两个来源都要检查，同名的重复在下面报告
+		if j, ok := ids[r.Id]; ok && r.Id != "" && con.Repos[j].Name != r.Name {
+			if r.Id == r.Name {
+				v.add(fmt.Sprintf("name %q is already used as id by repos[%d]", r.Name, j), "repos", i, "name")
+			} else {
+				v.add(fmt.Sprintf("id %q is already used by repos[%d]", r.Id, j), "repos", i, "id")
+			}
+		} else if !ok {
+			ids[r.Id] = i
+		}
+		if j, ok := names[r.Name]; ok && r.Name != "" {
+			v.add(fmt.Sprintf("name %q is already used by repos[%d]", r.Name, j), "repos", i, "name")
+		}
+		names[r.Name] = i
+		if strings.ContainsAny(r.Branch, " ~^:?*[\\") || strings.HasPrefix(r.Branch, "-") {
+			v.add(fmt.Sprintf("%q is not a valid branch name", r.Branch), "repos", i, "branch")
+		}
+		if r.Backend != BackendGoGit && r.Backend != BackendGit {
+			v.add(fmt.Sprintf("backend must be %s or %s", BackendGoGit, BackendGit), "repos", i, "backend")
+		}
+		// 继承的全局值已经检查过
+		if r.Ignore != con.Ignore {
+			v.notNegative(r.Ignore, "repos", i, "ignore")
+		}
+		if r.Debounce != con.Debounce {
+			v.notNegative(r.Debounce, "repos", i, "debounce")
+		}
+	}
+
+	// 仓库路径不能互相嵌套，否则外层仓库会提交内层仓库的文件
+	for i, a := range con.Repos {
+		for j, b := range con.Repos {
+			if i == j || a.Path == "" || b.Path == "" || paths[absPath(b.Path)] != j {
+				continue
+			}
+			if inside(absPath(b.Path), absPath(a.Path)) {
+				v.add(fmt.Sprintf("path is inside repos[%d] %s", j, b.Path), "repos", i, "path")
+			}
+		}
+	}
+}
+
+func (v *validator) validateProxy(p ProxyAuthConfig) {
+	if !p.Enable {
+		return
+	}
+	if len(p.Trusted) == 0 {
+		v.add("at least one trusted proxy is required", "auth", "proxy", "trusted")
+	}
+	for i, t := range p.Trusted {
+		if t == "unix" || net.ParseIP(t) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(t); err != nil {
+			v.add(fmt.Sprintf("%q is not an ip, cidr or unix", t), "auth", "proxy", "trusted", i)
+		}
+	}
+	for user, role := range p.Users {
+		if !slices.Contains(roles, role) {
+			v.add(fmt.Sprintf("unknown role %q, use read, write or admin", role), "auth", "proxy", "users", user)
+		}
+	}
+	if p.DefaultRole != "" && !slices.Contains(roles, p.DefaultRole) {
+		v.add(fmt.Sprintf("unknown role %q, use read, write or admin", p.DefaultRole), "auth", "proxy", "default_role")
+	}
+}
+
+func (v *validator) notNegative(n *int, path ...any) {
+	if n != nil && *n < 0 {
+		v.add("must not be negative", path...)
+	}
+}
+
+func absPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	return abs
+}
+
+// inside reports whether p is a subdirectory of dir.
+func inside(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
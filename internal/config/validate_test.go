@@ -0,0 +1,163 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseValid(t *testing.T) {
+	con, err := Parse([]byte(`debounce: 5
+repos:
+  - name: notes
+    path: /data/notes
+    url: https://example.com/notes.git
+`))
+	if err != nil {
+		t.Fatalf("Expected a valid config, got: %v", err)
+	}
+	if *con.Repos[0].Debounce != 5 || con.Repos[0].Branch != "master" || con.Repos[0].Id != "notes" {
+		t.Errorf("Expected defaults to be applied, got %+v", con.Repos[0])
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	_, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("Expected an empty config to be valid, got: %v", err)
+	}
+}
+
+func TestParseProblems(t *testing.T) {
+	con, err := Parse([]byte(`debounce: -1
+server:
+  port: 70000
+repos:
+  - name: notes
+    path: /data/notes
+    url: https://example.com/notes.git
+    brnach: main
+  - name: notes
+    path: /data/notes/inner
+  - path: /data/notes
+    url: https://example.com/other.git
+`))
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got: %v", err)
+	}
+	if con == nil {
+		t.Fatal("Expected the config to be returned with the problems")
+	}
+	want := []string{
+		"line 1: debounce: must not be negative",
+		"line 3: server.port: 70000 is not a valid port",
+		`line 8: unknown key "brnach"`,
+		`line 9: repos[1]: url is required`,
+		`line 9: repos[1].name: name "notes" is already used by repos[0]`,
+		"line 10: repos[1].path: path is inside repos[0] /data/notes",
+		"line 11: repos[2].path: path is already used by repos[0]",
+	}
+	got := strings.Split(verr.Error(), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d problems, got:\n%s", len(want), verr.Error())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("problem %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestParseDuplicateId(t *testing.T) {
+	_, err := Parse([]byte(`repos:
+  - name: notes
+    path: /data/notes
+    url: https://example.com/notes.git
+  - id: notes
+    name: photos
+    path: /data/photos
+    url: https://example.com/photos.git
+`))
+	if err == nil || err.Error() != `line 5: repos[1].id: id "notes" is already used by repos[0]` {
+		t.Fatalf("Expected a duplicate id, got: %v", err)
+	}
+}
+
+func TestParseDuplicateIdFromName(t *testing.T) {
+	_, err := Parse([]byte(`repos:
+  - id: notes
+    name: a
+    path: /data/a
+    url: https://example.com/a.git
+  - name: notes
+    path: /data/notes
+    url: https://example.com/notes.git
+`))
+	if err == nil || err.Error() != `line 6: repos[1].name: name "notes" is already used as id by repos[0]` {
+		t.Fatalf("Expected a duplicate id, got: %v", err)
+	}
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	_, err := Parse([]byte("repos: [\n"))
+	var verr ValidationError
+	if err == nil || errors.As(err, &verr) {
+		t.Fatalf("Expected a yaml syntax error, got: %v", err)
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "token")
+	err := os.WriteFile(secret, []byte("s3cret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GO_SYNC_TEST_PORT", "8080")
+	t.Setenv("GO_SYNC_TEST_PASSWORD", "p$ss")
+	con, err := Parse([]byte(`server:
+  port: ${GO_SYNC_TEST_PORT}
+user:
+  password: ${GO_SYNC_TEST_PASSWORD}
+repos:
+  - path: /data/notes
+    url: https://example.com/notes.git
+    token_file: ` + secret + `
+`))
+	if err != nil {
+		t.Fatalf("Expected a valid config, got: %v", err)
+	}
+	if con.Server.Port != 8080 || con.User.Password != "p$ss" || con.Repos[0].Password != "s3cret" {
+		t.Errorf("Expected secrets to be resolved, got %+v %+v", con.Server, con.Repos[0])
+	}
+
+	b, _ := json.Marshal(con.Redacted())
+	if strings.Contains(string(b), "s3cret") || strings.Contains(string(b), "p$ss") {
+		t.Errorf("Expected passwords to be redacted, got %s", b)
+	}
+	if con.Repos[0].Password != "s3cret" {
+		t.Error("Expected Redacted to leave the config unchanged")
+	}
+}
+
+func TestParseMissingSecrets(t *testing.T) {
+	_, err := Parse([]byte(`user:
+  password: ${GO_SYNC_TEST_UNSET}
+repos:
+  - path: /data/notes
+    url: https://example.com/notes.git
+    password: x
+    password_file: /nonexistent/password
+`))
+	var verr ValidationError
+	if !errors.As(err, &verr) || len(verr) != 3 {
+		t.Fatalf("Expected 3 problems, got: %v", err)
+	}
+	if verr[0].String() != "line 2: user.password: environment variable GO_SYNC_TEST_UNSET is not set" {
+		t.Errorf("unexpected problem: %s", verr[0])
+	}
+}
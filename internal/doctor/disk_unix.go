@@ -0,0 +1,14 @@
+//go:build !windows
+
+package doctor
+
+import "golang.org/x/sys/unix"
+
+func freeSpace(p string) (uint64, error) {
+	var st unix.Statfs_t
+	err := unix.Statfs(p, &st)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
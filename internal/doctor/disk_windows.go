@@ -0,0 +1,15 @@
+//go:build windows
+
+package doctor
+
+import "golang.org/x/sys/windows"
+
+func freeSpace(p string) (uint64, error) {
+	name, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	err = windows.GetDiskFreeSpaceEx(name, &free, nil, nil)
+	return free, err
+}
@@ -0,0 +1,321 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/internal/git"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+type Level string
+
+const (
+	Ok   Level = "ok"
+	Warn Level = "warn"
+	Fail Level = "fail"
+)
+
+type Result struct {
+	Repo    string `json:"repo,omitempty"` // 为空时是全局检查
+	Check   string `json:"check"`
+	Level   Level  `json:"level"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"` // 如何修复
+}
+
+// minFree is the free disk space below which a warning is reported.
+const minFree = 512 << 20
+
+type checker struct {
+	results []Result
+	repo    string
+}
+
+func (c *checker) add(check string, level Level, message, hint string) {
+	c.results = append(c.results, Result{Repo: c.repo, Check: check, Level: level, Message: message, Hint: hint})
+}
+
+// Run checks the config file at p, the environment and every configured
+// repository. It does not modify anything, repositories that do not exist yet
+// are not created.
+func Run(p string) []Result {
+	c := &checker{}
+	con, err := config.Load(p)
+	var verr config.ValidationError
+	switch {
+	case os.IsNotExist(err):
+		c.add("config", Fail, "config file not found: "+p, "run `go-sync init` to create one")
+		return c.results
+	case errors.As(err, &verr):
+		for _, problem := range verr {
+			c.add("config", Fail, problem.String(), "fix "+p)
+		}
+	case err != nil:
+		c.add("config", Fail, err.Error(), "fix "+p)
+		return c.results
+	}
+	checkConfig(c, con)
+
+	repos := &checker{}
+	dirs := 0
+	for _, rc := range con.Repos {
+		repos.repo = rc.Name
+		dirs += checkRepo(repos, rc)
+	}
+	// 全局检查排在各仓库之前
+	checkWatches(c, len(con.Repos), dirs)
+	return append(c.results, repos.results...)
+}
+
+// Failed reports whether any check failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Level == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+func checkConfig(c *checker, con *config.Config) {
+	if len(con.Repos) == 0 {
+		c.add("config", Fail, "no repositories configured", "run `go-sync init` or add a repository under `repos:`")
+		return
+	}
+	if con.User.Password == "admin123" {
+		c.add("config", Warn, "the web ui uses the default password", "change `user.password`")
+	}
+	if !con.Server.Tls.Enable && con.Server.Socket == "" && !isLoopback(con.Server.Host) {
+		c.add("config", Warn, fmt.Sprintf("web ui listens on %s without tls, passwords are sent in cleartext", con.Server.Host),
+			"enable `server.tls` or listen on 127.0.0.1 behind a https reverse proxy")
+	}
+	if !Failed(c.results) {
+		c.add("config", Ok, fmt.Sprintf("%d repositories configured", len(con.Repos)), "")
+	}
+}
+
+// checkRepo returns the number of directories that will be watched.
+func checkRepo(c *checker, rc config.RepoConfig) int {
+	if rc.Backend == config.BackendGit {
+		bin, err := exec.LookPath("git")
+		if err != nil {
+			c.add("backend", Fail, "git is not installed", "install git or remove `backend: git`")
+			return 0
+		}
+		c.add("backend", Ok, "git binary: "+bin, "")
+	}
+	info, err := os.Stat(rc.Path)
+	if os.IsNotExist(err) {
+		c.add("path", Warn, "path does not exist: "+rc.Path, "it is created and initialised on the next `go-sync run`")
+		checkRemote(c, rc, nil)
+		checkDisk(c, rc.Path)
+		return 0
+	}
+	if err != nil {
+		c.add("path", Fail, err.Error(), "check the permissions of "+rc.Path)
+		return 0
+	}
+	if !info.IsDir() {
+		c.add("path", Fail, "path is not a directory: "+rc.Path, "point `path` to a directory")
+		return 0
+	}
+	c.add("path", Ok, rc.Path, "")
+	checkDisk(c, rc.Path)
+	dirs := countDirs(rc.Path)
+
+	r := git.NewGitRepo(rc)
+	err = r.OpenExisting()
+	if err != nil {
+		c.add("git", Warn, "not a git repository: "+err.Error(), "it is initialised on the next `go-sync run`, existing files will be committed")
+		checkRemote(c, rc, nil)
+		return dirs
+	}
+	c.add("git", Ok, "git repository", "")
+
+	t, err := r.Tracking()
+	if err != nil {
+		c.add("branch", Fail, "can not read HEAD: "+err.Error(), "repair the repository with `git status` in "+rc.Path)
+		return dirs
+	}
+	checkTracking(c, rc, t)
+	checkRemote(c, rc, func(remote string) {
+		checkHistory(c, rc, r, t, remote)
+	})
+	return dirs
+}
+
+func checkTracking(c *checker, rc config.RepoConfig, t git.Tracking) {
+	if t.RemoteUrl == "" {
+		c.add("remote", Fail, "remote origin is missing", fmt.Sprintf("run `git remote add origin %s` in %s", rc.Url, rc.Path))
+	} else if t.RemoteUrl != rc.Url {
+		c.add("remote", Warn, fmt.Sprintf("origin is %s but the config says %s", t.RemoteUrl, rc.Url),
+			fmt.Sprintf("run `git remote set-url origin %s` in %s or fix `url`", rc.Url, rc.Path))
+	}
+	if t.Head != "" && t.Head != rc.Branch {
+		c.add("branch", Fail, fmt.Sprintf("HEAD is on %s but the config says %s", t.Head, rc.Branch),
+			fmt.Sprintf("run `git checkout %s` in %s or fix `branch`", rc.Branch, rc.Path))
+		return
+	}
+	if t.Remote != "origin" || t.Merge != "refs/heads/"+rc.Branch {
+		c.add("branch", Warn, fmt.Sprintf("%s does not track origin/%s", rc.Branch, rc.Branch),
+			fmt.Sprintf("run `git branch -u origin/%s` in %s", rc.Branch, rc.Path))
+		return
+	}
+	c.add("branch", Ok, fmt.Sprintf("%s tracks origin/%s", rc.Branch, rc.Branch), "")
+}
+
+// checkRemote checks that the remote is reachable, the credentials are
+// accepted and the branch exists, then calls history with its commit.
+func checkRemote(c *checker, rc config.RepoConfig, history func(remote string)) {
+	if rc.Url == "" {
+		return
+	}
+	// backend: git 时用 git ls-remote，和同步时一样使用 git 的凭据和代理设置
+	branches, err := git.NewGitRepo(rc).RemoteBranches()
+	switch {
+	case err == nil:
+		c.add("remote", Ok, "reachable: "+rc.Url, "")
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		c.add("credentials", Fail, "credentials were rejected: "+err.Error(),
+			"check `username` and `password`, for token based hosts put the access token in `password`")
+		return
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		c.add("remote", Fail, "repository not found: "+rc.Url,
+			"check `url`, private repositories also report not found when the credentials have no access")
+		return
+	default:
+		c.add("remote", Fail, "can not reach "+rc.Url+": "+err.Error(), "check the network, proxy and `url`")
+		return
+	}
+	c.add("credentials", Ok, "accepted", "")
+
+	hash, ok := branches[rc.Branch]
+	if !ok {
+		if len(branches) == 0 {
+			c.add("branch", Warn, "the remote repository is empty", "it is created on the first push")
+		} else {
+			c.add("branch", Warn, fmt.Sprintf("branch %s does not exist on the remote, it has: %s", rc.Branch, strings.Join(keys(branches), ", ")),
+				"fix `branch`, otherwise it is created on the first push")
+		}
+		return
+	}
+	if history != nil {
+		history(hash)
+	}
+}
+
+func checkHistory(c *checker, rc config.RepoConfig, r *git.GitRepo, t git.Tracking, remote string) {
+	rel, err := r.Relation(t.Hash, remote)
+	if err != nil {
+		c.add("history", Fail, "can not compare with the remote: "+err.Error(), "")
+		return
+	}
+	if rel == git.Unknown {
+		// 远程有尚未拉取的提交，本地在上次拉取后没有新提交时可以快进
+		if t.Hash == "" || t.Hash == t.Fetched {
+			rel = git.Behind
+		} else if t.Fetched != "" {
+			c.add("history", Warn, "the remote has new commits and there are local commits that were not pushed",
+				fmt.Sprintf("run `git fetch` and `git status` in %s, the histories may have diverged", rc.Path))
+			return
+		}
+	}
+	switch rel {
+	case git.Same:
+		c.add("history", Ok, "up to date with origin/"+rc.Branch, "")
+	case git.Ahead:
+		c.add("history", Ok, "local commits will be pushed", "")
+	case git.Behind:
+		c.add("history", Ok, "remote commits will be pulled", "")
+	case git.Diverged:
+		c.add("history", Fail, fmt.Sprintf("%s and origin/%s have diverged, go-sync can only fast-forward", rc.Branch, rc.Branch),
+			fmt.Sprintf("merge or rebase manually, e.g. `git pull --rebase origin %s` in %s", rc.Branch, rc.Path))
+	default:
+		c.add("history", Warn, "can not tell whether the histories diverged", fmt.Sprintf("run `git fetch` in %s", rc.Path))
+	}
+}
+
+func checkDisk(c *checker, p string) {
+	// 路径不存在时检查最近的上级目录
+	for {
+		if _, err := os.Stat(p); err == nil {
+			break
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return
+		}
+		p = parent
+	}
+	free, err := freeSpace(p)
+	if err != nil {
+		c.add("disk", Warn, "can not read free disk space: "+err.Error(), "")
+		return
+	}
+	if free < minFree {
+		c.add("disk", Warn, fmt.Sprintf("only %d MiB free", free>>20), "free up disk space, commits fail when the disk is full")
+		return
+	}
+	c.add("disk", Ok, fmt.Sprintf("%d MiB free", free>>20), "")
+}
+
+func checkWatches(c *checker, repos, dirs int) {
+	limit, instances, err := watchLimits()
+	if err != nil || limit <= 0 {
+		return
+	}
+	if dirs > limit*8/10 {
+		c.add("inotify", Fail, fmt.Sprintf("%d directories to watch but fs.inotify.max_user_watches is %d", dirs, limit),
+			fmt.Sprintf("raise it, e.g. `sysctl -w fs.inotify.max_user_watches=%d` and persist it in /etc/sysctl.d", nextLimit(dirs)))
+	} else {
+		c.add("inotify", Ok, fmt.Sprintf("%d directories to watch, limit %d", dirs, limit), "")
+	}
+	if instances > 0 && repos > instances {
+		c.add("inotify", Fail, fmt.Sprintf("%d repositories but fs.inotify.max_user_instances is %d", repos, instances),
+			"raise it with `sysctl -w fs.inotify.max_user_instances=512`")
+	}
+}
+
+func nextLimit(dirs int) int {
+	n := 524288
+	for n < dirs*2 {
+		n *= 2
+	}
+	return n
+}
+
+func countDirs(root string) int {
+	n := 0
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func isLoopback(host string) bool {
+	return host == "localhost" || host == "::1" || strings.HasPrefix(host, "127.")
+}
+
+func keys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+func TestCheckConfig(t *testing.T) {
+	con := &config.Config{Repos: []config.RepoConfig{{Name: "a", Path: "/a", Url: "https://example.com/a.git"}}}
+	con.User.Password = "admin123"
+	con.Server.Host = "0.0.0.0"
+
+	c := &checker{}
+	checkConfig(c, con)
+	levels := map[Level]int{}
+	for _, r := range c.results {
+		levels[r.Level]++
+	}
+	// 默认密码和明文监听警告
+	if levels[Warn] != 2 || levels[Fail] != 0 {
+		t.Fatalf("unexpected results: %+v", c.results)
+	}
+}
+
+func TestCheckConfigOk(t *testing.T) {
+	con := &config.Config{Repos: []config.RepoConfig{{Name: "a", Path: "/a", Url: "https://example.com/a.git"}}}
+	con.User.Password = "secret"
+	con.Server.Host = "127.0.0.1"
+
+	c := &checker{}
+	checkConfig(c, con)
+	if len(c.results) != 1 || c.results[0].Level != Ok {
+		t.Fatalf("unexpected results: %+v", c.results)
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(p, []byte("repos:\n  - path: /a\n    urll: x\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := Run(p)
+	if !Failed(res) || len(res) < 2 || res[1].Message != `line 3: unknown key "urll"` {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package doctor
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+func watchLimits() (watches int, instances int, err error) {
+	watches, err = readInt("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0, 0, err
+	}
+	instances, _ = readInt("/proc/sys/fs/inotify/max_user_instances")
+	return watches, instances, nil
+}
+
+func readInt(p string) (int, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package doctor
+
+// watchLimits is only known on linux, other platforms have no such limit.
+func watchLimits() (watches int, instances int, err error) {
+	return 0, 0, nil
+}
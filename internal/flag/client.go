@@ -0,0 +1,84 @@
+package flag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+// client calls the api of a running go-sync with an api token.
+type client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func newClient(opts *Options) *client {
+	return &client{
+		base:  strings.TrimRight(opts.Api, "/") + "/api/",
+		token: opts.Token,
+		http:  &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (c *client) call(name string, req any, data any) error {
+	if req == nil {
+		req = struct{}{}
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, c.base+name, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	var res struct {
+		Code int             `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if res.Code != 200 {
+		return fmt.Errorf("%s: %s (%d)", name, res.Msg, res.Code)
+	}
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Data, data)
+}
+
+// repoId resolves a repository id, name or 1-based position to the id used
+// by the api.
+func (c *client) repoId(name string) (string, error) {
+	var repos []config.RepoConfig
+	err := c.call("repos", nil, &repos)
+	if err != nil {
+		return "", err
+	}
+	rc, err := findRepo(repos, name)
+	if err != nil {
+		return "", err
+	}
+	return rc.Id, nil
+}
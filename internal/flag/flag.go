@@ -1 +1,574 @@
 package flag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/internal/doctor"
+	"github.com/charghet/go-sync/internal/git"
+	"github.com/charghet/go-sync/internal/run"
+	"github.com/charghet/go-sync/internal/web"
+	"github.com/charghet/go-sync/pkg/logger"
+)
+
+type Options struct {
+	Config   string
+	LogLevel string
+	NoWeb    bool
+	Api      string // 非空时通过运行中的 go-sync 接口执行
+	Token    string
+}
+
+type command struct {
+	usage string
+	desc  string
+	run   func(opts *Options, args []string) error
+	flags func(fs *flag.FlagSet)
+}
+
+var commands map[string]*command
+
+var order = []string{"init", "run", "once", "status", "log", "revert", "sync", "doctor"}
+
+func init() {
+	commands = map[string]*command{
+		"init":   {usage: "init", desc: "create a config file interactively", run: initCmd},
+		"run":    {usage: "run", desc: "watch repositories and serve the web ui", run: runCmd},
+		"once":   {usage: "once", desc: "pull, commit and push every repository once and exit", run: onceCmd, flags: onceFlags},
+		"status": {usage: "status", desc: "show the state of every repository", run: statusCmd},
+		"log":    {usage: "log <repo>", desc: "list the commits of a repository", run: logCmd, flags: logFlags},
+		"revert": {usage: "revert <repo> <hash> [files]", desc: "restore files from a commit", run: revertCmd, flags: revertFlags},
+		"sync":   {usage: "sync <repo>", desc: "pull, commit and push a repository now", run: syncCmd},
+		"doctor": {usage: "doctor", desc: "check the config, repositories and environment", run: doctorCmd, flags: doctorFlags},
+	}
+}
+
+var out io.Writer = os.Stdout
+
+var dist web.EmbedFS
+
+// Execute runs the command line and returns the process exit code.
+func Execute(args []string, d web.EmbedFS) int {
+	dist = d
+	opts := &Options{}
+	global := newFlagSet("go-sync", opts)
+	global.Usage = usage(global)
+	err := global.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	name := "run"
+	args = global.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command:", name)
+		global.Usage()
+		return 2
+	}
+
+	sub := &Options{}
+	fs := newFlagSet("go-sync "+name, sub)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: go-sync [options] %s\n\n%s\n\nOptions:\n", cmd.usage, cmd.desc)
+		fs.PrintDefaults()
+	}
+	args, err = parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	opts.merge(sub)
+
+	if name != "run" {
+		// 命令输出使用 stdout，日志输出到 stderr
+		logger.SetOutput(os.Stderr)
+	}
+	if opts.LogLevel == "" && name != "run" && name != "once" {
+		// 命令行输出时只显示警告和错误
+		opts.LogLevel = "warn"
+	}
+	if opts.LogLevel != "" {
+		err = logger.SetLevel(opts.LogLevel)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	// doctor 自己读取配置，以便报告所有错误而不是直接退出
+	if opts.Config != "" && name != "init" && name != "doctor" {
+		config.SetPath(opts.Config)
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv("GO_SYNC_TOKEN")
+	}
+
+	err = cmd.run(opts, args)
+	if err != nil {
+		var u usageErr
+		if errors.As(err, &u) {
+			fmt.Fprintln(os.Stderr, u.Error())
+			fs.Usage()
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		var e exitErr
+		if errors.As(err, &e) {
+			return e.code
+		}
+		return 1
+	}
+	return 0
+}
+
+func newFlagSet(name string, opts *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&opts.Config, "config", "", "path of the config file (default config.yaml)")
+	fs.StringVar(&opts.LogLevel, "log-level", "", "log level: debug, info, warn or error")
+	fs.BoolVar(&opts.NoWeb, "no-web", false, "do not start the web ui")
+	fs.StringVar(&opts.Api, "api", "", "url of a running go-sync, e.g. http://127.0.0.1:2222")
+	fs.StringVar(&opts.Token, "token", "", "api token for --api (default $GO_SYNC_TOKEN)")
+	return fs
+}
+
+// merge applies the options given after the command name.
+func (o *Options) merge(sub *Options) {
+	if sub.Config != "" {
+		o.Config = sub.Config
+	}
+	if sub.LogLevel != "" {
+		o.LogLevel = sub.LogLevel
+	}
+	if sub.NoWeb {
+		o.NoWeb = true
+	}
+	if sub.Api != "" {
+		o.Api = sub.Api
+	}
+	if sub.Token != "" {
+		o.Token = sub.Token
+	}
+}
+
+// parseInterspersed allows options after the positional arguments,
+// e.g. "log myrepo -n 5".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		w := fs.Output()
+		fmt.Fprintln(w, "Usage: go-sync [options] <command> [arguments]")
+		fmt.Fprintln(w, "\nCommands:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, name := range order {
+			fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].desc)
+		}
+		tw.Flush()
+		fmt.Fprintln(w, "\nOptions:")
+		fs.PrintDefaults()
+	}
+}
+
+// exitErr sets the exit code without printing the usage.
+type exitErr struct {
+	code int
+	msg  string
+}
+
+func (e exitErr) Error() string {
+	return e.msg
+}
+
+type usageErr string
+
+func (e usageErr) Error() string {
+	return string(e)
+}
+
+func runCmd(opts *Options, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	timeout := time.Duration(config.GetConfig().ShutdownTimeout) * time.Second
+
+	// 没有 web ui 时无法添加仓库
+	if opts.NoWeb && len(config.GetConfig().Repos) == 0 {
+		logger.Warn("No repositories configured, run `go-sync init` to add one, exiting.")
+		return nil
+	}
+	r := run.GetRunner()
+	r.Run(ctx)
+	r.WatchConfig(ctx)
+	go reloadOnHangup(ctx, r)
+	webDone := make(chan struct{})
+	if opts.NoWeb {
+		close(webDone)
+	} else {
+		go func() {
+			web.StartUp(ctx, dist, timeout)
+			close(webDone)
+		}()
+	}
+	<-ctx.Done()
+	// 再次收到信号时直接退出
+	stop()
+	logger.Info("Waiting for pending changes to be committed...")
+	ok := r.Wait(timeout)
+	<-webDone
+	if !ok {
+		return fmt.Errorf("pending changes were not pushed within %v", timeout)
+	}
+	logger.Info("go-sync stopped.")
+	return nil
+}
+
+// reloadOnHangup reloads the config on SIGHUP, like most daemons.
+func reloadOnHangup(ctx context.Context, r *run.Runner) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("[config]", "Received SIGHUP, reloading config.")
+			r.Reload()
+		}
+	}
+}
+
+var onceJson bool
+
+func onceFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&onceJson, "json", false, "print a json summary on stdout")
+}
+
+func onceCmd(opts *Options, args []string) error {
+	res := run.GetRunner().Once()
+	failed := 0
+	for _, r := range res {
+		if !r.Ok {
+			failed++
+		}
+	}
+	if onceJson {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Ok     bool             `json:"ok"`
+			Failed int              `json:"failed"`
+			Repos  []run.OnceResult `json:"repos"`
+		}{failed == 0, failed, res})
+		if err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tRESULT\tHEAD\tTIME")
+		for _, r := range res {
+			result := "ok"
+			if !r.Ok {
+				result = "failed: " + r.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.1fs\n", r.Name, result, shortHash(r.Head), r.Duration)
+		}
+		tw.Flush()
+	}
+	if failed > 0 {
+		return exitErr{code: 1, msg: fmt.Sprintf("%d of %d repositories failed", failed, len(res))}
+	}
+	return nil
+}
+
+func statusCmd(opts *Options, args []string) error {
+	var status []git.Status
+	if opts.Api != "" {
+		err := newClient(opts).call("status", nil, &status)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, rc := range config.GetConfig().Repos {
+			r := git.NewGitRepo(rc)
+			if err := openExisting(r); err != nil {
+				status = append(status, git.Status{Name: rc.Name, Path: rc.Path, Branch: rc.Branch, Error: err.Error()})
+				continue
+			}
+			status = append(status, r.Status())
+		}
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tBRANCH\tHEAD\tCHANGES\tPATH")
+	for _, s := range status {
+		state := strconv.Itoa(s.Changes)
+		if s.Error != "" {
+			state = "error: " + s.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Branch, shortHash(s.Head), state, s.Path)
+	}
+	return tw.Flush()
+}
+
+var doctorJson bool
+
+func doctorFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&doctorJson, "json", false, "print the results as json")
+}
+
+func doctorCmd(opts *Options, args []string) error {
+	p := opts.Config
+	if p == "" {
+		p = config.Path()
+	}
+	res := doctor.Run(p)
+	if doctorJson {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(res)
+		if err != nil {
+			return err
+		}
+	} else {
+		repo := "-"
+		for _, r := range res {
+			if r.Repo != repo {
+				repo = r.Repo
+				if repo == "" {
+					fmt.Fprintln(out, "general")
+				} else {
+					fmt.Fprintln(out, "repo", repo)
+				}
+			}
+			fmt.Fprintf(out, "  [%-4s] %-11s %s\n", r.Level, r.Check, r.Message)
+			if r.Hint != "" && r.Level != doctor.Ok {
+				fmt.Fprintf(out, "         %-11s hint: %s\n", "", r.Hint)
+			}
+		}
+	}
+	if doctor.Failed(res) {
+		return exitErr{code: 1, msg: "some checks failed"}
+	}
+	return nil
+}
+
+var logSize, logPage int
+
+func logFlags(fs *flag.FlagSet) {
+	fs.IntVar(&logSize, "n", 20, "number of commits to show")
+	fs.IntVar(&logPage, "page", 1, "page of commits to show")
+}
+
+func logCmd(opts *Options, args []string) error {
+	if len(args) != 1 {
+		return usageErr("log needs a repository")
+	}
+	var commits []git.Commit
+	var total int
+	if opts.Api != "" {
+		c := newClient(opts)
+		id, err := c.repoId(args[0])
+		if err != nil {
+			return err
+		}
+		var res struct {
+			Total int          `json:"total"`
+			List  []git.Commit `json:"list"`
+		}
+		err = c.call("commits", map[string]any{"id": id, "pager": map[string]int{"index": logPage, "size": logSize}}, &res)
+		if err != nil {
+			return err
+		}
+		commits, total = res.List, res.Total
+	} else {
+		r, err := openRepo(args[0], false)
+		if err != nil {
+			return err
+		}
+		commits, total, err = r.GetCommit(logPage, logSize)
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range commits {
+		fmt.Fprintf(out, "%s %s %s %s\n", shortHash(c.Hash), c.Date, c.Author, firstLine(c.Message))
+	}
+	fmt.Fprintf(out, "(%d commits)\n", total)
+	return nil
+}
+
+var revertOpts git.RestoreOptions
+
+func revertFlags(fs *flag.FlagSet) {
+	fs.StringVar(&revertOpts.Dir, "dir", "", "write the files below this directory instead of the repository")
+	fs.BoolVar(&revertOpts.Suffix, "suffix", false, "write each file next to the current one as <name>.restored-<hash>")
+	fs.BoolVar(&revertOpts.Commit, "commit", false, "commit copies written inside the repository")
+}
+
+func revertCmd(opts *Options, args []string) error {
+	if len(args) < 2 {
+		return usageErr("revert needs a repository and a commit hash")
+	}
+	files := args[2:]
+	if len(files) == 0 {
+		files = []string{"."}
+	}
+	if revertOpts.Dir != "" {
+		// 相对于当前目录，而不是仓库
+		dir, err := filepath.Abs(revertOpts.Dir)
+		if err != nil {
+			return err
+		}
+		revertOpts.Dir = dir
+	}
+	var res []git.RestoreResult
+	if opts.Api != "" {
+		c := newClient(opts)
+		id, err := c.repoId(args[0])
+		if err != nil {
+			return err
+		}
+		err = c.call("revert", map[string]any{"id": id, "hash": args[1], "file": files, "dir": revertOpts.Dir, "suffix": revertOpts.Suffix, "commit": revertOpts.Commit}, &res)
+		if err != nil {
+			return err
+		}
+	} else {
+		r, err := openRepo(args[0], false)
+		if err != nil {
+			return err
+		}
+		res, err = r.RevertFile(args[1], files, revertOpts)
+		if err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, x := range res {
+		if x.Error != "" {
+			failed++
+			fmt.Fprintf(out, "failed   %s: %s\n", x.File, x.Error)
+		} else {
+			fmt.Fprintf(out, "restored %s -> %s\n", x.File, x.Path)
+		}
+	}
+	if failed > 0 {
+		return exitErr{code: 1, msg: fmt.Sprintf("%d of %d files failed", failed, len(res))}
+	}
+	return nil
+}
+
+func syncCmd(opts *Options, args []string) error {
+	if len(args) != 1 {
+		return usageErr("sync needs a repository")
+	}
+	if opts.Api != "" {
+		c := newClient(opts)
+		id, err := c.repoId(args[0])
+		if err != nil {
+			return err
+		}
+		return c.call("sync", map[string]any{"id": id}, nil)
+	}
+	r, err := openRepo(args[0], true)
+	if err != nil {
+		return err
+	}
+	return r.Sync("sync in " + time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// findRepo looks a repository up by its id, name or 1-based position.
+func findRepo(repos []config.RepoConfig, name string) (config.RepoConfig, error) {
+	for _, rc := range repos {
+		if rc.Id == name {
+			return rc, nil
+		}
+	}
+	for _, rc := range repos {
+		if rc.Name == name {
+			return rc, nil
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i > 0 && i <= len(repos) {
+		return repos[i-1], nil
+	}
+	return config.RepoConfig{}, fmt.Errorf("repository not found: %s", name)
+}
+
+// openRepo opens the repository name, a missing repository is initialised if
+// create is set and an error otherwise.
+func openRepo(name string, create bool) (*git.GitRepo, error) {
+	rc, err := findRepo(config.GetConfig().Repos, name)
+	if err != nil {
+		return nil, err
+	}
+	r := git.NewGitRepo(rc)
+	if create {
+		err = r.Open(false)
+	} else {
+		err = openExisting(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// openExisting opens r for commands that only read it, they never create
+// the repository.
+func openExisting(r *git.GitRepo) error {
+	err := r.OpenExisting()
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return fmt.Errorf("repository does not exist: %s", r.RepoConfig.Path)
+	}
+	return err
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+func firstLine(s string) string {
+	for i, c := range s {
+		if c == '\n' {
+			return s[:i]
+		}
+	}
+	return s
+}
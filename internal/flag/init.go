@@ -0,0 +1,262 @@
+package flag
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/internal/git"
+	"github.com/charghet/go-sync/pkg/util"
+)
+
+// prompter asks questions on the terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *prompter) line() (string, error) {
+	s, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || s == "") {
+		return "", err
+	}
+	return strings.TrimSpace(s), nil
+}
+
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	s, err := p.line()
+	if err != nil {
+		return "", err
+	}
+	if s == "" {
+		return def, nil
+	}
+	return s, nil
+}
+
+func (p *prompter) required(question, def string) (string, error) {
+	for {
+		s, err := p.ask(question, def)
+		if err != nil || s != "" {
+			return s, err
+		}
+		fmt.Fprintln(p.out, "  a value is required")
+	}
+}
+
+func (p *prompter) secret(question string) (string, error) {
+	fmt.Fprintf(p.out, "%s: ", question)
+	return withoutEcho(p.line)
+}
+
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+	s, err := p.ask(question+" ("+d+")", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(s) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (p *prompter) number(question string, def int) (int, error) {
+	for {
+		s, err := p.ask(question, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(s)
+		if err == nil && n > 0 {
+			return n, nil
+		}
+		fmt.Fprintln(p.out, "  please enter a positive number")
+	}
+}
+
+func initCmd(opts *Options, args []string) error {
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: out}
+	path := opts.Config
+	if path == "" {
+		path = config.Path()
+	}
+	if _, err := os.Stat(path); err == nil {
+		ok, err := p.confirm(fmt.Sprintf("%s already exists, overwrite it?", path), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("aborted, config file was not changed")
+		}
+	}
+
+	fmt.Fprintln(out, "Repository")
+	var repo config.RepoConfig
+	var err error
+	repo.Path, err = p.required("  local path", "")
+	if err != nil {
+		return err
+	}
+	checkRepoPath(repo.Path)
+	repo.Name, err = p.required("  name", filepath.Base(repo.Path))
+	if err != nil {
+		return err
+	}
+	for {
+		err = askRemote(p, &repo)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "  testing connection to", repo.Url, "...")
+		branches, err := git.LsRemote(repo.Url, repo.Username, repo.Password)
+		if err == nil {
+			err = checkBranch(p, repo.Branch, branches)
+			if err == nil {
+				break
+			}
+		} else {
+			fmt.Fprintln(out, "  connection failed:", err)
+		}
+		retry, err := p.confirm("  change the remote settings and try again?", true)
+		if err != nil {
+			return err
+		}
+		if !retry {
+			keep, err := p.confirm("  write the config anyway?", false)
+			if err != nil {
+				return err
+			}
+			if !keep {
+				return errors.New("aborted, config file was not written")
+			}
+			break
+		}
+	}
+	repo.Email, err = p.ask("  commit email", "go-sync@example.com")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Web UI")
+	con := &config.Config{}
+	con.Server.Host, err = p.required("  listen host", "127.0.0.1")
+	if err != nil {
+		return err
+	}
+	con.Server.Port, err = p.number("  listen port", 2222)
+	if err != nil {
+		return err
+	}
+	con.User.Username, err = p.required("  username", "admin")
+	if err != nil {
+		return err
+	}
+	con.User.Password, err = p.secret("  password (empty to generate one)")
+	if err != nil {
+		return err
+	}
+	generated := con.User.Password == ""
+	if generated {
+		con.User.Password = util.RandomHex(8)
+	}
+	con.Repos = []config.RepoConfig{repo}
+
+	err = config.Write(path, con)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "\nWrote", path)
+	if generated {
+		fmt.Fprintln(out, "Web UI password:", con.User.Password)
+	}
+	fmt.Fprintf(out, "Start syncing with: go-sync --config %s run\n", path)
+	return nil
+}
+
+func askRemote(p *prompter, repo *config.RepoConfig) error {
+	var err error
+	repo.Url, err = p.required("  remote url", repo.Url)
+	if err != nil {
+		return err
+	}
+	def := repo.Branch
+	if def == "" {
+		def = "master"
+	}
+	repo.Branch, err = p.required("  branch", def)
+	if err != nil {
+		return err
+	}
+	repo.Username, err = p.ask("  remote username", repo.Username)
+	if err != nil {
+		return err
+	}
+	password, err := p.secret("  remote password or token (empty to keep)")
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		repo.Password = password
+	}
+	return nil
+}
+
+func checkBranch(p *prompter, branch string, branches []string) error {
+	if len(branches) == 0 {
+		fmt.Fprintln(out, "  ok, the remote repository is empty")
+		return nil
+	}
+	if slices.Contains(branches, branch) {
+		fmt.Fprintln(out, "  ok, found branch", branch)
+		return nil
+	}
+	fmt.Fprintf(out, "  branch %s not found, remote branches: %s\n", branch, strings.Join(branches, ", "))
+	create, err := p.confirm("  create "+branch+" on the first push?", false)
+	if err != nil {
+		return err
+	}
+	if !create {
+		return errors.New("branch not found")
+	}
+	return nil
+}
+
+func checkRepoPath(p string) {
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(out, "  the directory will be created on first run")
+		return
+	}
+	if err != nil || !info.IsDir() {
+		fmt.Fprintln(out, "  warning: not a directory:", p)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(p, ".git")); err == nil {
+		fmt.Fprintln(out, "  existing git repository")
+		return
+	}
+	entries, _ := os.ReadDir(p)
+	if len(entries) > 0 {
+		fmt.Fprintln(out, "  warning: the directory is not empty, its files will be committed and pushed")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package flag
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// withoutEcho runs read with terminal echo turned off, so passwords are not
+// shown while typing.
+func withoutEcho(read func() (string, error)) (string, error) {
+	fd := int(os.Stdin.Fd())
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		// stdin 不是终端
+		return read()
+	}
+	noEcho := *t
+	noEcho.Lflag &^= unix.ECHO
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, &noEcho)
+	if err != nil {
+		return read()
+	}
+	defer unix.IoctlSetTermios(fd, unix.TCSETS, t)
+	s, err := read()
+	os.Stdout.WriteString("\n")
+	return s, err
+}
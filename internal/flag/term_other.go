@@ -0,0 +1,7 @@
+//go:build !linux
+
+package flag
+
+func withoutEcho(read func() (string, error)) (string, error) {
+	return read()
+}
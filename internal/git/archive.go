@@ -0,0 +1,216 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// Archive is the tree of a commit, or some paths of it, to be written as
+// an archive.
+type Archive struct {
+	commit *object.Commit
+	tree   *object.Tree
+	paths  []string
+	prefix string // 所有文件所在的目录
+}
+
+// Archive prepares an archive of the commit hash, HEAD if empty, limited to
+// paths if given. Missing paths are reported here, before anything is
+// written.
+func (r *GitRepo) Archive(hash string, paths []string) (*Archive, error) {
+	repo := r.repo()
+	if repo == nil {
+		return nil, errors.New("repository is not opened")
+	}
+	h := plumbing.NewHash(hash)
+	if hash == "" {
+		h = r.headHash()
+		if h.IsZero() {
+			return nil, errors.New("repository has no commits")
+		}
+	} else if !plumbing.IsHash(hash) {
+		return nil, fmt.Errorf("invalid hash: %s", hash)
+	}
+	commit, err := repo.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{commit: commit, tree: tree}
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if p == "" {
+			// 包含根目录时就是整个提交
+			a.paths = nil
+			break
+		}
+		_, err := tree.FindEntry(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		a.paths = append(a.paths, p)
+	}
+	a.prefix = fmt.Sprintf("%s-%s", archiveName(r.RepoConfig.Name), commit.Hash.String()[:7])
+	return a, nil
+}
+
+// archiveName makes name usable as a file name.
+func archiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "repo"
+	}
+	return name
+}
+
+// Name is the file name of the archive for format.
+func (a *Archive) Name(format string) string {
+	return a.prefix + "." + format
+}
+
+// Write streams the archive in format to w, entries are written as the tree
+// is walked.
+func (a *Archive) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatZip:
+		zw := zip.NewWriter(w)
+		err := a.walk(func(f *object.File) error {
+			return a.writeZip(zw, f)
+		})
+		return errors.Join(err, zw.Close())
+	case FormatTarGz:
+		gw := gzip.NewWriter(w)
+		tw := tar.NewWriter(gw)
+		err := a.walk(func(f *object.File) error {
+			return a.writeTar(tw, f)
+		})
+		return errors.Join(err, tw.Close(), gw.Close())
+	}
+	return fmt.Errorf("unknown archive format: %s", format)
+}
+
+// walk calls fn for every file below the paths, submodules are skipped.
+func (a *Archive) walk(fn func(f *object.File) error) error {
+	if a.paths == nil {
+		return a.tree.Files().ForEach(fn)
+	}
+	for _, p := range a.paths {
+		e, err := a.tree.FindEntry(p)
+		if err != nil {
+			return err
+		}
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+		if e.Mode != filemode.Dir {
+			f, err := a.tree.TreeEntryFile(e)
+			if err != nil {
+				return err
+			}
+			f.Name = p
+			err = fn(f)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		sub, err := a.tree.Tree(p)
+		if err != nil {
+			return err
+		}
+		err = sub.Files().ForEach(func(f *object.File) error {
+			f.Name = p + "/" + f.Name
+			return fn(f)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) modTime() time.Time {
+	return a.commit.Committer.When
+}
+
+func fileMode(m filemode.FileMode) fs.FileMode {
+	switch m {
+	case filemode.Executable:
+		return 0755
+	case filemode.Symlink:
+		return fs.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+func (a *Archive) writeZip(zw *zip.Writer, f *object.File) error {
+	hdr := &zip.FileHeader{
+		Name:     a.prefix + "/" + f.Name,
+		Method:   zip.Deflate,
+		Modified: a.modTime(),
+	}
+	hdr.SetMode(fileMode(f.Mode))
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	return copyBlob(w, f)
+}
+
+func (a *Archive) writeTar(tw *tar.Writer, f *object.File) error {
+	hdr := &tar.Header{
+		Name:    a.prefix + "/" + f.Name,
+		Mode:    int64(fileMode(f.Mode).Perm()),
+		ModTime: a.modTime(),
+		Size:    f.Size,
+	}
+	if f.Mode == filemode.Symlink {
+		target, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, target, 0
+		return tw.WriteHeader(hdr)
+	}
+	hdr.Typeflag = tar.TypeReg
+	err := tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	return copyBlob(tw, f)
+}
+
+func copyBlob(w io.Writer, f *object.File) error {
+	r, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
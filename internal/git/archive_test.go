@@ -0,0 +1,125 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+type archiveFile struct {
+	content string
+	mode    os.FileMode
+}
+
+func readZip(t *testing.T, b []byte) map[string]archiveFile {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := map[string]archiveFile{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		res[f.Name] = archiveFile{string(content), f.Mode()}
+	}
+	return res
+}
+
+func readTarGz(t *testing.T, b []byte) map[string]archiveFile {
+	gr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	res := map[string]archiveFile{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		res[hdr.Name] = archiveFile{string(content), hdr.FileInfo().Mode()}
+	}
+	return res
+}
+
+func TestArchive(t *testing.T) {
+	r := newTestRepo(t, config.BackendGoGit, map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "c"})
+	writeFile(t, filepath.Join(r.RepoConfig.Path, "run.sh"), "#!/bin/sh\n")
+	os.Chmod(filepath.Join(r.RepoConfig.Path, "run.sh"), 0755)
+	r.Commit("add run.sh")
+	h := head(t, r)
+	prefix := "test-" + h[:7] + "/"
+
+	a, err := r.Archive("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name(FormatTarGz) != "test-"+h[:7]+".tar.gz" {
+		t.Errorf("Name = %s", a.Name(FormatTarGz))
+	}
+	want := map[string]archiveFile{
+		prefix + "a.txt":         {"a", 0644},
+		prefix + "dir/b.txt":     {"b", 0644},
+		prefix + "dir/sub/c.txt": {"c", 0644},
+		prefix + "run.sh":        {"#!/bin/sh\n", 0755},
+	}
+	for _, format := range []string{FormatZip, FormatTarGz} {
+		var buf bytes.Buffer
+		err = a.Write(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]archiveFile
+		if format == FormatZip {
+			got = readZip(t, buf.Bytes())
+		} else {
+			got = readTarGz(t, buf.Bytes())
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", format, got, want)
+		}
+		for name, w := range want {
+			if got[name] != w {
+				t.Errorf("%s: %s = %+v, want %+v", format, name, got[name], w)
+			}
+		}
+	}
+
+	a, err = r.Archive(h, []string{"/dir/sub/", "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = a.Write(&buf, FormatZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readZip(t, buf.Bytes())
+	if len(got) != 2 || got[prefix+"dir/sub/c.txt"].content != "c" || got[prefix+"a.txt"].content != "a" {
+		t.Errorf("paths: got %v", got)
+	}
+
+	_, err = r.Archive(h, []string{"missing"})
+	if err == nil {
+		t.Error("missing path: no error")
+	}
+	_, err = r.Archive("xyz", nil)
+	if err == nil {
+		t.Error("invalid hash: no error")
+	}
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// Backend runs the git operations of a repository. Paths are slash separated
+// and relative to the worktree.
+type Backend interface {
+	// Open opens the existing repository, git.ErrRepositoryNotExists if
+	// there is none.
+	Open() error
+	// Init creates the repository with origin and the configured branch.
+	Init() error
+	Clone() error
+	// Add stages paths like `git add -A`: new and modified files are added,
+	// deleted files removed and ignored files skipped. Directories are added
+	// recursively, nil stages the whole worktree.
+	Add(paths []string) error
+	// Status lists the paths with staged or unstaged changes.
+	Status() ([]string, error)
+	// Commit commits the index, ErrNothingToCommit if it equals HEAD.
+	Commit(message string, author object.Signature) (string, error)
+	// Push pushes the branch to origin, up to date is no error.
+	Push() error
+	// Pull fast-forwards the branch from origin, a remote without the
+	// branch is no error.
+	Pull() error
+	// RemoteBranches maps the branches of the configured url to their
+	// commits, the repository does not need to exist.
+	RemoteBranches() (map[string]string, error)
+	// Log lists commits newest first, none if there is no commit yet.
+	Log(opts LogOptions) ([]Commit, error)
+	// Diff lists the files changed by a commit compared to its first parent,
+	// with renames, copies and line counts. go-git only finds copies with
+	// the same content.
+	Diff(hash string) ([]Change, error)
+	Checkout(hash string, files []string) error
+	// Reset resets the index and HEAD to hash, or only files if given.
+	Reset(hash string, files []string) error
+	// Repository reads objects and refs, which both backends store in the
+	// same format on disk.
+	Repository() *git.Repository
+}
+
+type LogOptions struct {
+	From  string // 起始提交，为空时从 HEAD 开始
+	Limit int    // 最多返回的数量，0 为不限
+	CommitQuery
+}
+
+// CommitQuery selects commits, empty fields match every commit.
+type CommitQuery struct {
+	Since time.Time // 提交时间不早于
+	Until time.Time // 提交时间不晚于
+	// 作者名字或邮箱包含的文字，不区分大小写
+	Author string
+	// 提交信息包含的文字，不区分大小写
+	Message string
+	// 修改了匹配的文件，如 *.md 或 docs/*，不含 / 时匹配任意目录下的名字
+	Path string
+}
+
+func (q CommitQuery) IsZero() bool {
+	return q == CommitQuery{}
+}
+
+// matchPath reports whether the slash separated name, or one of its parent
+// directories, matches the glob pattern. A pattern without a slash matches
+// the name of a file or directory at any depth.
+func matchPath(pattern, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	anyDepth := !strings.Contains(pattern, "/")
+	for p := name; p != "."; p = path.Dir(p) {
+		target := p
+		if anyDepth {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrNothingToCommit = errors.New("nothing to commit")
+
+func newBackend(rc *config.RepoConfig) Backend {
+	if rc.Backend == config.BackendGit {
+		return &cliBackend{rc: rc}
+	}
+	return &goGitBackend{rc: rc}
+}
@@ -0,0 +1,658 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+// eachBackend runs test once for every backend, the git binary is skipped
+// if it is not installed.
+func eachBackend(t *testing.T, test func(t *testing.T, backend string)) {
+	for _, backend := range []string{config.BackendGoGit, config.BackendGit} {
+		t.Run(backend, func(t *testing.T) {
+			if backend == config.BackendGit {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+			}
+			test(t, backend)
+		})
+	}
+}
+
+// newTestRepo inits a repository in a temp dir with files committed.
+func newTestRepo(t testing.TB, backend string, files map[string]string) *GitRepo {
+	r := newEmptyRepo(t, backend, t.TempDir(), t.TempDir())
+	for name, content := range files {
+		writeFile(t, filepath.Join(r.RepoConfig.Path, name), content)
+	}
+	_, err := r.Commit("init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func newEmptyRepo(t testing.TB, backend, dir, url string) *GitRepo {
+	r := NewGitRepo(config.RepoConfig{Name: "test", Path: dir, Url: url, Branch: "main", Username: "test", Email: "test@example.com", Backend: backend})
+	err := r.Open(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func writeFile(t testing.TB, p, content string) {
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(p, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func status(t *testing.T, r *GitRepo) []string {
+	s, err := r.backend.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(s)
+	return s
+}
+
+func head(t *testing.T, r *GitRepo) string {
+	ref, err := r.repo().Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Hash().String()
+}
+
+func TestBackendCommit(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newEmptyRepo(t, backend, t.TempDir(), t.TempDir())
+		commits, total, err := r.GetCommit(1, 10)
+		if err != nil || total != 0 || len(commits) != 0 {
+			t.Fatalf("GetCommit on an empty repository = %v, %d, %v", commits, total, err)
+		}
+		c, err := r.Commit("empty")
+		if err != nil || c {
+			t.Fatalf("Commit without files = %v, %v", c, err)
+		}
+
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), "a")
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "dir", "b.txt"), "b")
+		if s := status(t, r); !slices.Equal(s, []string{"a.txt", "dir/b.txt"}) {
+			t.Errorf("Status = %v", s)
+		}
+		c, err = r.Commit("first\n\nwith body\n")
+		if err != nil || !c {
+			t.Fatalf("Commit = %v, %v", c, err)
+		}
+		if s := status(t, r); len(s) != 0 {
+			t.Errorf("Status after commit = %v", s)
+		}
+		if st := r.Status(); st.Changes != 0 || st.Head != head(t, r) {
+			t.Errorf("Status() = %+v", st)
+		}
+		c, err = r.Commit("again")
+		if err != nil || c {
+			t.Fatalf("Commit without changes = %v, %v", c, err)
+		}
+
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), "a2")
+		c, err = r.Commit("second")
+		if err != nil || !c {
+			t.Fatalf("Commit = %v, %v", c, err)
+		}
+		commits, total, err = r.GetCommit(1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2 || len(commits) != 1 {
+			t.Fatalf("GetCommit(1, 1) = %v, %d", commits, total)
+		}
+		if commits[0].Hash != head(t, r) || commits[0].Message != "second" || commits[0].Author != "test" || commits[0].Email != "test@example.com" {
+			t.Errorf("commits[0] = %+v", commits[0])
+		}
+		commits, _, err = r.GetCommit(2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(commits) != 1 || commits[0].Message != "first\n\nwith body\n" {
+			t.Errorf("GetCommit(2, 1) = %v", commits)
+		}
+	})
+}
+
+func TestBackendDiff(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newTestRepo(t, backend, map[string]string{"a.txt": "a", "b.txt": "b"})
+		changes, err := r.GetChange(head(t, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Change{
+			{Action: "A", Name: "a.txt", Added: 1, SizeDelta: 1},
+			{Action: "A", Name: "b.txt", Added: 1, SizeDelta: 1},
+		}
+		if !slices.Equal(changes, want) {
+			t.Errorf("GetChange of the first commit = %v, want %v", changes, want)
+		}
+
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), "a2")
+		os.Remove(filepath.Join(r.RepoConfig.Path, "b.txt"))
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "c/d.txt"), "d")
+		_, err = r.Commit("change")
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err = r.GetChange(head(t, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = []Change{
+			{Action: "M", Name: "a.txt", Added: 1, Removed: 1, SizeDelta: 1},
+			{Action: "D", Name: "b.txt", Removed: 1, SizeDelta: -1},
+			{Action: "A", Name: "c/d.txt", Added: 1, SizeDelta: 1},
+		}
+		if !slices.Equal(changes, want) {
+			t.Errorf("GetChange = %v, want %v", changes, want)
+		}
+	})
+}
+
+func TestBackendDiffRenames(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		text := strings.Repeat("a line of text\n", 20)
+		r := newTestRepo(t, backend, map[string]string{"old.txt": text, "src.txt": "copied\n", "bin": "x\x00y"})
+		root := r.RepoConfig.Path
+		os.Remove(filepath.Join(root, "old.txt"))
+		writeFile(t, filepath.Join(root, "dir", "new.txt"), text+"one more\n")
+		// 和 git -C 一样，只有同一提交中修改的文件才是复制的来源
+		writeFile(t, filepath.Join(root, "copy.txt"), "copied\n")
+		writeFile(t, filepath.Join(root, "src.txt"), "copied\nchanged\n")
+		writeFile(t, filepath.Join(root, "bin"), "x\x00yz")
+		_, err := r.Commit("move")
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := r.GetChange(head(t, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Name, b.Name) })
+		want := []Change{
+			{Action: "M", Name: "bin", Binary: true, SizeDelta: 1},
+			{Action: "C", Name: "copy.txt", OldName: "src.txt"},
+			{Action: "R", Name: "dir/new.txt", OldName: "old.txt", Added: 1, SizeDelta: 9},
+			{Action: "M", Name: "src.txt", Added: 1, SizeDelta: 8},
+		}
+		if !slices.Equal(changes, want) {
+			t.Errorf("GetChange = %+v, want %+v", changes, want)
+		}
+
+		commits, _, err := r.Commits(CommitQuery{}, "", 0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := commits[0].Stats; s == nil || *s != (CommitStats{Files: 4, Added: 2}) {
+			t.Errorf("Stats = %+v", s)
+		}
+		if s := commits[1].Stats; s == nil || *s != (CommitStats{Files: 3, Added: 21}) {
+			t.Errorf("Stats of the first commit = %+v", s)
+		}
+
+		big := strings.Repeat("x\n", maxLineStats/2+1)
+		writeFile(t, filepath.Join(root, "big.txt"), big)
+		r.Commit("big")
+		writeFile(t, filepath.Join(root, "big.txt"), big+"y\n")
+		r.Commit("bigger")
+		changes, err = r.GetChange(head(t, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Change{{Action: "M", Name: "big.txt", Binary: true, SizeDelta: 2}}; !slices.Equal(changes, want) {
+			t.Errorf("GetChange of a large file = %+v, want %+v", changes, want)
+		}
+	})
+}
+
+func TestBackendCheckoutReset(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newTestRepo(t, backend, map[string]string{"a.txt": "v1", "dir/b.txt": "v1"})
+		v1 := head(t, r)
+		a := filepath.Join(r.RepoConfig.Path, "a.txt")
+		b := filepath.Join(r.RepoConfig.Path, "dir", "b.txt")
+		writeFile(t, a, "v2")
+		writeFile(t, b, "v2")
+		_, err := r.Commit("v2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2 := head(t, r)
+
+		err = r.Checkout(v1, []string{"dir"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readFile(t, b) != "v1" || readFile(t, a) != "v2" || head(t, r) != v2 {
+			t.Errorf("Checkout(v1, dir) changed a.txt or HEAD, or not dir/b.txt")
+		}
+		if s := status(t, r); !slices.Equal(s, []string{"dir/b.txt"}) {
+			t.Errorf("Status after checkout = %v", s)
+		}
+
+		err = r.Reset(v2, []string{"dir/b.txt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readFile(t, b) != "v1" || head(t, r) != v2 {
+			t.Errorf("Reset(v2, dir/b.txt) changed the worktree or HEAD")
+		}
+		err = r.Restore([]string{"dir/b.txt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readFile(t, b) != "v2" || len(status(t, r)) != 0 {
+			t.Errorf("Restore did not discard the change")
+		}
+
+		err = r.Reset(v1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head(t, r) != v1 || readFile(t, a) != "v2" {
+			t.Errorf("Reset(v1) did not move HEAD or changed the worktree")
+		}
+		if s := status(t, r); !slices.Equal(s, []string{"a.txt", "dir/b.txt"}) {
+			t.Errorf("Status after reset = %v", s)
+		}
+	})
+}
+
+func TestBackendRemote(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		remote := t.TempDir()
+		_, err := git.PlainInit(remote, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := newEmptyRepo(t, backend, t.TempDir(), remote)
+		err = a.Pull()
+		if err != nil {
+			t.Fatalf("Pull from an empty remote: %v", err)
+		}
+		writeFile(t, filepath.Join(a.RepoConfig.Path, "a.txt"), "a")
+		err = a.Sync("from a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := NewGitRepo(config.RepoConfig{Name: "b", Path: filepath.Join(t.TempDir(), "b"), Url: remote, Branch: "main", Backend: backend})
+		err = b.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readFile(t, filepath.Join(b.RepoConfig.Path, "a.txt")) != "a" {
+			t.Error("Clone did not check out a.txt")
+		}
+		writeFile(t, filepath.Join(b.RepoConfig.Path, "b.txt"), "b")
+		err = b.Sync("from b")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = a.Pull()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readFile(t, filepath.Join(a.RepoConfig.Path, "b.txt")) != "b" || head(t, a) != head(t, b) {
+			t.Error("Pull did not fast-forward to the commit of b")
+		}
+		commits, total, err := a.GetCommit(0, 0)
+		if err != nil || total != 2 || !strings.HasPrefix(commits[0].Message, "from b") {
+			t.Errorf("GetCommit after pull = %v, %d, %v", commits, total, err)
+		}
+	})
+}
+
+func TestCommitsCursor(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newEmptyRepo(t, backend, t.TempDir(), t.TempDir())
+		for i := range 5 {
+			writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), strings.Repeat("a", i+1))
+			_, err := r.Commit(strings.Repeat("a", i+1))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if total, err := r.Total(); err != nil || total != 5 {
+			t.Fatalf("Total = %d, %v", total, err)
+		}
+
+		var messages []string
+		cursor := ""
+		for {
+			commits, next, err := r.Commits(CommitQuery{}, cursor, 0, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range commits {
+				messages = append(messages, c.Message)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if want := []string{"aaaaa", "aaaa", "aaa", "aa", "a"}; !slices.Equal(messages, want) {
+			t.Errorf("pages = %v, want %v", messages, want)
+		}
+
+		// 新提交不影响已有 cursor 的页面
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), "b")
+		_, err := r.Commit("b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits, _, err := r.Commits(CommitQuery{}, cursor, 0, 2)
+		if err != nil || len(commits) != 1 || commits[0].Message != "a" {
+			t.Errorf("Commits(cursor) after a new commit = %v, %v", commits, err)
+		}
+		if total, err := r.Total(); err != nil || total != 6 {
+			t.Errorf("Total after commit = %d, %v", total, err)
+		}
+
+		err = r.Reset(cursor, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total, err := r.Total(); err != nil || total != 1 {
+			t.Errorf("Total after reset = %d, %v", total, err)
+		}
+		commits, total, err := r.GetCommit(1, 10)
+		if err != nil || total != 1 || len(commits) != 1 {
+			t.Errorf("GetCommit after reset = %v, %d, %v", commits, total, err)
+		}
+	})
+}
+
+func TestCommitsQuery(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newEmptyRepo(t, backend, t.TempDir(), t.TempDir())
+		day := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+		commit := func(name, email, message string, files ...string) {
+			for _, f := range files {
+				writeFile(t, filepath.Join(r.RepoConfig.Path, f), message)
+			}
+			err := r.backend.Add(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = r.backend.Commit(message, object.Signature{Name: name, Email: email, When: day})
+			if err != nil {
+				t.Fatal(err)
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		commit("laptop", "me@laptop", "Add notes", "notes/a.md")       // 01-01
+		commit("desktop", "me@desktop", "auto commit", "src/main.go")  // 01-02
+		commit("laptop", "me@laptop", "auto commit", "notes/sub/b.md") // 01-03
+		commit("phone", "me@phone", "Fix typo in notes", "README.md")  // 01-04
+
+		tests := []struct {
+			q    CommitQuery
+			want []string
+		}{
+			{CommitQuery{Author: "LAPTOP"}, []string{"auto commit", "Add notes"}},
+			{CommitQuery{Author: "@desktop"}, []string{"auto commit"}},
+			{CommitQuery{Message: "notes"}, []string{"Fix typo in notes", "Add notes"}},
+			{CommitQuery{Path: "*.md"}, []string{"Fix typo in notes", "auto commit", "Add notes"}},
+			{CommitQuery{Path: "notes"}, []string{"auto commit", "Add notes"}},
+			{CommitQuery{Path: "notes/*.md"}, []string{"Add notes"}},
+			{CommitQuery{Path: "src/*"}, []string{"auto commit"}},
+			{CommitQuery{Since: time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local), Until: time.Date(2025, 1, 3, 23, 0, 0, 0, time.Local)}, []string{"auto commit", "auto commit"}},
+			{CommitQuery{Author: "laptop", Message: "auto", Path: "*.md"}, []string{"auto commit"}},
+			{CommitQuery{Author: "nobody"}, nil},
+		}
+		for _, tt := range tests {
+			commits, next, err := r.Commits(tt.q, "", 0, 10)
+			if err != nil {
+				t.Fatalf("%+v: %v", tt.q, err)
+			}
+			var messages []string
+			for _, c := range commits {
+				messages = append(messages, c.Message)
+			}
+			if !slices.Equal(messages, tt.want) || next != "" {
+				t.Errorf("%+v: %q next %q, want %q", tt.q, messages, next, tt.want)
+			}
+		}
+
+		commits, next, err := r.Commits(CommitQuery{Path: "*.md"}, "", 0, 1)
+		if err != nil || len(commits) != 1 || next == "" {
+			t.Fatalf("first page = %v, %q, %v", commits, next, err)
+		}
+		commits, next, err = r.Commits(CommitQuery{Path: "*.md"}, next, 0, 2)
+		if err != nil || len(commits) != 2 || next != "" || commits[1].Message != "Add notes" {
+			t.Errorf("second page = %v, %q, %v", commits, next, err)
+		}
+		_, _, err = r.Commits(CommitQuery{Path: "["}, "", 0, 1)
+		if err == nil {
+			t.Error("expected an error for an invalid pattern")
+		}
+	})
+}
+
+// TestSyncConcurrent runs Sync while files are committed like the watcher
+// does, without writeMu git fails on .git/index.lock.
+func TestSyncConcurrent(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		remote := t.TempDir()
+		_, err := git.PlainInit(remote, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newEmptyRepo(t, backend, t.TempDir(), remote)
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			p := filepath.Join(r.RepoConfig.Path, fmt.Sprintf("f%d.txt", i))
+			writeFile(t, p, "f")
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if _, err := r.CommitPaths("watch", []string{p}); err != nil {
+					t.Error(err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if err := r.Sync("sync"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if s := status(t, r); len(s) != 0 {
+			t.Errorf("status = %v", s)
+		}
+	})
+}
+
+func TestCliWorkdir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	outer := newTestRepo(t, config.BackendGit, map[string]string{"a.txt": "a"})
+	t.Chdir(outer.RepoConfig.Path)
+
+	// 不能退回到 go-sync 所在目录的仓库
+	b := newBackend(&config.RepoConfig{Name: "missing", Path: "missing", Branch: "main", Backend: config.BackendGit})
+	if _, err := b.Status(); err == nil {
+		t.Error("Status of a missing worktree: no error")
+	}
+
+	os.Mkdir("clone", 0755)
+	c := NewGitRepo(config.RepoConfig{Name: "clone", Path: "clone", Url: outer.RepoConfig.Path, Branch: "main", Backend: config.BackendGit})
+	err := c.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join("clone", "a.txt")); got != "a" {
+		t.Errorf("clone/a.txt = %q", got)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		remote := t.TempDir()
+		_, err := git.PlainInit(remote, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newRepo := func(p string) *GitRepo {
+			return NewGitRepo(config.RepoConfig{Name: "test", Path: p, Url: remote, Branch: "main", Username: "test", Email: "test@example.com", Backend: backend})
+		}
+
+		// 远程没有分支时初始化
+		a := newRepo(filepath.Join(t.TempDir(), "a"))
+		err = a.Create(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(a.RepoConfig.Path, "a.txt"), "a")
+		err = a.Sync("from a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := newRepo(filepath.Join(t.TempDir(), "b"))
+		err = b.Create(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readFile(t, filepath.Join(b.RepoConfig.Path, "a.txt")) != "a" || head(t, b) != head(t, a) {
+			t.Error("Create did not clone the remote branch")
+		}
+
+		// 已有文件的目录不会被克隆覆盖
+		c := newRepo(t.TempDir())
+		writeFile(t, filepath.Join(c.RepoConfig.Path, "c.txt"), "c")
+		err = c.Create(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(c.RepoConfig.Path, "a.txt")); err == nil {
+			t.Error("Create cloned into a directory with files")
+		}
+	})
+}
+
+func TestRemoteBranches(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		remote := t.TempDir()
+		_, err := git.PlainInit(remote, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newEmptyRepo(t, backend, t.TempDir(), remote)
+		branches, err := r.RemoteBranches()
+		if err != nil || len(branches) != 0 {
+			t.Errorf("RemoteBranches of an empty remote = %v, %v", branches, err)
+		}
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), "a")
+		err = r.Sync("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		branches, err = r.RemoteBranches()
+		if err != nil || len(branches) != 1 || branches["main"] != head(t, r) {
+			t.Errorf("RemoteBranches = %v, %v", branches, err)
+		}
+
+		missing := NewGitRepo(config.RepoConfig{Name: "missing", Path: t.TempDir(), Url: filepath.Join(remote, "missing"), Backend: backend})
+		_, err = missing.RemoteBranches()
+		if !errors.Is(err, transport.ErrRepositoryNotFound) {
+			t.Errorf("RemoteBranches of a missing remote = %v", err)
+		}
+	})
+}
+
+// TestOptionHash sends a hash that git would take as an option, which must
+// neither be run nor write the file.
+func TestOptionHash(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newTestRepo(t, backend, map[string]string{"a.txt": "a"})
+		victim := filepath.Join(t.TempDir(), "victim.txt")
+		writeFile(t, victim, "keep")
+		hash := "--output=" + victim
+
+		if _, err := r.GetChange(hash); err == nil {
+			t.Error("GetChange: no error")
+		}
+		// 绕过 GetChange 的检查
+		r.backend.Diff(hash)
+		r.backend.Log(LogOptions{From: hash})
+		r.backend.Checkout(hash, nil)
+		r.backend.Reset(hash, nil)
+		r.backend.Reset(hash, []string{"a.txt"})
+		if got := readFile(t, victim); got != "keep" {
+			t.Errorf("victim.txt = %q", got)
+		}
+	})
+}
+
+// TestCliRepositoryConcurrent reads objects while git packs them, run with
+// -race.
+func TestCliRepositoryConcurrent(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	r := newTestRepo(t, config.BackendGit, map[string]string{"a.txt": "a"})
+	h := head(t, r)
+	pack := filepath.Join(r.RepoConfig.Path, ".git", "objects", "pack")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := r.repo().CommitObject(plumbing.NewHash(h)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		mod := time.Now().Add(time.Duration(i) * time.Second)
+		os.Chtimes(pack, mod, mod)
+		r.repo()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,544 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+// cliBackend runs the git binary, which supports what go-git lacks, like gc,
+// LFS and credential helpers. Objects are still read with go-git.
+type cliBackend struct {
+	rc       *config.RepoConfig
+	mu       sync.Mutex // 保护 repo 和 packTime，web 请求和监听会同时读取
+	repo     *git.Repository
+	packTime time.Time // objects/pack 的修改时间，变化后重新打开仓库
+}
+
+// gitCmd runs git in the worktree.
+func (b *cliBackend) gitCmd(stdin []byte, args ...string) ([]byte, error) {
+	return b.run(stdin, nil, args...)
+}
+
+// literalPaths passes paths to git literally, never as glob patterns.
+// check-ignore does not support it.
+var literalPaths = []string{"GIT_LITERAL_PATHSPECS=1"}
+
+// run runs git in the worktree with env added to the environment. It fails
+// if the worktree does not exist, git would otherwise find the repository
+// of the working directory.
+func (b *cliBackend) run(stdin []byte, env []string, args ...string) ([]byte, error) {
+	return runGit(b.rc.Path, stdin, env, args...)
+}
+
+// runGit runs git in dir, git never prompts for input. An empty dir is the
+// working directory of go-sync, only for commands that do not need a
+// repository.
+func runGit(dir string, stdin []byte, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C")
+	cmd.Env = append(cmd.Env, env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		// -c 选项之后才是子命令
+		i := 0
+		for i+2 < len(args) && args[i] == "-c" {
+			i += 2
+		}
+		return stdout.Bytes(), &cliError{Command: args[i], Msg: msg, err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+type cliError struct {
+	Command string
+	Msg     string // git 输出的错误信息
+	err     error
+}
+
+func (e *cliError) Error() string {
+	return fmt.Sprintf("git %s: %s", e.Command, e.Msg)
+}
+
+func (e *cliError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code of a failed git command, -1 if it did not run.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// remoteCmd runs a command that talks to origin. The configured credentials
+// are handed to git through a credential helper reading the environment, so
+// they do not show up in the process list. Without credentials the helpers
+// configured for git are used.
+func (b *cliBackend) remoteCmd(args ...string) ([]byte, error) {
+	opts, env := credentials(b.rc)
+	return b.run(nil, env, append(opts, args...)...)
+}
+
+// credentials returns the git options and environment for remoteCmd, none
+// without credentials.
+func credentials(rc *config.RepoConfig) (opts, env []string) {
+	if rc.Username == "" && rc.Password == "" {
+		return nil, nil
+	}
+	helper := `!f() { test "$1" = get && echo "username=$GO_SYNC_USERNAME" && echo "password=$GO_SYNC_PASSWORD"; }; f`
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + helper},
+		[]string{"GO_SYNC_USERNAME=" + rc.Username, "GO_SYNC_PASSWORD=" + rc.Password}
+}
+
+// Repository returns the repository opened with go-git. Objects git packed in
+// the meantime, e.g. by pull or gc, are picked up by opening the repository
+// again when the pack directory changed. go-git's Reindex is not safe while
+// objects are read, a new Repository leaves the one other callers hold alone.
+func (b *cliBackend) Repository() *git.Repository {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.repo == nil {
+		return nil
+	}
+	info, err := os.Stat(filepath.Join(b.rc.Path, ".git", "objects", "pack"))
+	if err == nil && !info.ModTime().Equal(b.packTime) {
+		repo, err := git.PlainOpen(b.rc.Path)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("[%v]", b.rc.Name), "Failed to reopen repository:", err)
+			return b.repo
+		}
+		b.repo, b.packTime = repo, info.ModTime()
+	}
+	return b.repo
+}
+
+func (b *cliBackend) Open() error {
+	_, err := os.Stat(filepath.Join(b.rc.Path, ".git"))
+	if os.IsNotExist(err) {
+		return git.ErrRepositoryNotExists
+	}
+	_, err = b.gitCmd(nil, "rev-parse", "--git-dir")
+	if err != nil {
+		return err
+	}
+	return b.openRepo()
+}
+
+func (b *cliBackend) openRepo() error {
+	repo, err := git.PlainOpen(b.rc.Path)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.repo = repo
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *cliBackend) Init() error {
+	err := os.MkdirAll(b.rc.Path, 0755)
+	if err != nil {
+		return err
+	}
+	cmds := [][]string{
+		{"init", "-q", "-b", b.rc.Branch},
+		{"remote", "add", "origin", b.rc.Url},
+		{"config", "branch." + b.rc.Branch + ".remote", "origin"},
+		{"config", "branch." + b.rc.Branch + ".merge", "refs/heads/" + b.rc.Branch},
+	}
+	for _, args := range cmds {
+		_, err = b.gitCmd(nil, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return b.openRepo()
+}
+
+// Clone is the only command run outside of the worktree, which does not
+// exist yet.
+func (b *cliBackend) Clone() error {
+	path, err := filepath.Abs(b.rc.Path)
+	if err != nil {
+		return err
+	}
+	opts, env := credentials(b.rc)
+	_, err = runGit("", nil, env, append(opts, "clone", "-q", "-b", b.rc.Branch, "--", b.rc.Url, path)...)
+	if err != nil {
+		return err
+	}
+	return b.openRepo()
+}
+
+func (b *cliBackend) Add(paths []string) error {
+	if paths == nil {
+		_, err := b.gitCmd(nil, "add", "-A")
+		return err
+	}
+	var existing, deleted []string
+	for _, rel := range paths {
+		_, err := os.Lstat(filepath.Join(b.rc.Path, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			deleted = append(deleted, rel)
+		} else {
+			existing = append(existing, rel)
+		}
+	}
+	// git add 明确指定被忽略的路径时会报错，先排除
+	existing, err := b.notIgnored(existing)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		_, err = b.run(nulList(existing), literalPaths, "add", "-A", "--pathspec-from-file=-", "--pathspec-file-nul")
+		if err != nil {
+			return err
+		}
+	}
+	if len(deleted) > 0 {
+		_, err = b.run(nulList(deleted), literalPaths, "rm", "-r", "-q", "--cached", "--ignore-unmatch", "--pathspec-from-file=-", "--pathspec-file-nul")
+	}
+	return err
+}
+
+func (b *cliBackend) notIgnored(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return paths, nil
+	}
+	out, err := b.gitCmd(nulList(paths), "check-ignore", "-z", "--stdin")
+	if exitCode(err) == 1 {
+		// 没有被忽略的路径
+		return paths, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ignored := map[string]bool{}
+	for _, p := range splitNul(out) {
+		ignored[p] = true
+	}
+	res := paths[:0]
+	for _, p := range paths {
+		if !ignored[p] {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func nulList(paths []string) []byte {
+	return []byte(strings.Join(paths, "\x00") + "\x00")
+}
+
+func splitNul(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
+
+func (b *cliBackend) Status() ([]string, error) {
+	out, err := b.gitCmd(nil, "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	entries := splitNul(out)
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if len(e) < 4 {
+			continue
+		}
+		res = append(res, e[3:])
+		if e[0] == 'R' || e[0] == 'C' {
+			// 重命名后面跟着原路径
+			i++
+		}
+	}
+	return res, nil
+}
+
+func (b *cliBackend) Commit(message string, author object.Signature) (string, error) {
+	_, err := b.gitCmd(nil, "diff", "--cached", "--quiet")
+	if err == nil {
+		return "", ErrNothingToCommit
+	}
+	if exitCode(err) != 1 {
+		return "", err
+	}
+	name := author.Name
+	if name == "" {
+		// git 不允许空的名字，go-git 允许
+		name = "go-sync"
+	}
+	date := author.When.Format(time.RFC3339)
+	_, err = b.run([]byte(message), []string{
+		"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + author.Email, "GIT_AUTHOR_DATE=" + date,
+		"GIT_COMMITTER_NAME=" + name, "GIT_COMMITTER_EMAIL=" + author.Email, "GIT_COMMITTER_DATE=" + date,
+	}, "-c", "commit.gpgsign=false", "commit", "-q", "--no-verify", "--allow-empty-message", "--cleanup=verbatim", "-F", "-")
+	if err != nil {
+		return "", err
+	}
+	out, err := b.gitCmd(nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (b *cliBackend) Push() error {
+	ref := "refs/heads/" + b.rc.Branch
+	_, err := b.remoteCmd("push", "-q", "origin", ref+":"+ref)
+	return err
+}
+
+func (b *cliBackend) Pull() error {
+	_, err := b.remoteCmd("pull", "-q", "--ff-only", "--no-rebase", "origin", b.rc.Branch)
+	var cerr *cliError
+	if errors.As(err, &cerr) && strings.Contains(cerr.Msg, "couldn't find remote ref") {
+		logger.Info(fmt.Sprintf("[%v]", b.rc.Name), "Nothing to pull, remote branch does not exist yet:", b.rc.Branch)
+		return nil
+	}
+	return err
+}
+
+// RemoteBranches runs git ls-remote outside of the worktree.
+func (b *cliBackend) RemoteBranches() (map[string]string, error) {
+	opts, env := credentials(b.rc)
+	out, err := runGit("", nil, env, append(opts, "ls-remote", "--heads", "--", b.rc.Url)...)
+	if err != nil {
+		return nil, remoteErr(err)
+	}
+	branches := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		hash, ref, ok := strings.Cut(line, "\t")
+		if name, isBranch := strings.CutPrefix(ref, "refs/heads/"); ok && isBranch {
+			branches[name] = hash
+		}
+	}
+	return branches, nil
+}
+
+// remoteErrs maps the messages of git to the errors go-git returns, so
+// callers can tell rejected credentials from a missing repository.
+var remoteErrs = []struct {
+	msg string
+	err error
+}{
+	{"could not read Username", transport.ErrAuthenticationRequired},
+	{"could not read Password", transport.ErrAuthenticationRequired},
+	{"Authentication failed", transport.ErrAuthorizationFailed},
+	{"returned error: 403", transport.ErrAuthorizationFailed},
+	{"Repository not found", transport.ErrRepositoryNotFound},
+	{"does not appear to be a git repository", transport.ErrRepositoryNotFound},
+}
+
+// remoteErr wraps err of a remote command with the matching go-git error.
+func remoteErr(err error) error {
+	var cerr *cliError
+	if !errors.As(err, &cerr) {
+		return err
+	}
+	for _, e := range remoteErrs {
+		if strings.Contains(cerr.Msg, e.msg) {
+			return fmt.Errorf("%w: %w", e.err, err)
+		}
+	}
+	return err
+}
+
+func (b *cliBackend) Log(opts LogOptions) ([]Commit, error) {
+	from := opts.From
+	if from == "" {
+		_, err := b.gitCmd(nil, "rev-parse", "-q", "--verify", "HEAD")
+		if err != nil {
+			// 还没有提交
+			return nil, nil
+		}
+		from = "HEAD"
+	}
+	args := []string{"log", "-z", "--format=%H%x1f%an%x1f%ae%x1f%ad%x1f%B", "--date=format:%Y-%m-%d %H:%M:%S"}
+	if opts.Limit > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", opts.Limit))
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since="+opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, "--until="+opts.Until.Format(time.RFC3339))
+	}
+	if opts.Author != "" || opts.Message != "" {
+		args = append(args, "--fixed-strings", "--regexp-ignore-case")
+	}
+	if opts.Author != "" {
+		args = append(args, "--author="+opts.Author)
+	}
+	if opts.Message != "" {
+		args = append(args, "--grep="+opts.Message)
+	}
+	args = append(args, "--end-of-options", from, "--")
+	if opts.Path != "" {
+		args = append(args, globPathspecs(opts.Path)...)
+	}
+	out, err := b.gitCmd(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, record := range splitNul(out) {
+		f := strings.SplitN(record, "\x1f", 5)
+		if len(f) < 5 {
+			return nil, fmt.Errorf("unexpected git log output: %q", record)
+		}
+		commits = append(commits, Commit{Hash: f[0], Author: f[1], Email: f[2], Date: f[3], Message: f[4]})
+	}
+	return commits, nil
+}
+
+// globPathspecs matches the same paths as matchPath.
+func globPathspecs(pattern string) []string {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return []string{":(glob)" + pattern, ":(glob)" + pattern + "/**"}
+}
+
+func (b *cliBackend) Diff(hash string) ([]Change, error) {
+	out, err := b.gitCmd(nil, "rev-list", "--parents", "-n", "1", "--end-of-options", hash, "--")
+	if err != nil {
+		return nil, err
+	}
+	// --raw 给出状态和内容的 hash，--numstat 给出行数，顺序相同
+	// 超过 bigFileThreshold 的文件按二进制处理，不计算行数
+	args := []string{"-c", "core.bigFileThreshold=" + strconv.Itoa(maxLineStats),
+		"diff-tree", "-r", "-z", "-M", "-C", "--no-commit-id", "--no-abbrev", "--raw", "--numstat"}
+	if parents := strings.Fields(string(out)); len(parents) > 1 {
+		args = append(args, "--end-of-options", parents[1], hash)
+	} else {
+		args = append(args, "--root", "--end-of-options", hash)
+	}
+	out, err = b.gitCmd(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	var res []Change
+	n := 0 // 已读取行数的文件
+	f := splitNul(out)
+	for i := 0; i < len(f); i++ {
+		if strings.HasPrefix(f[i], ":") {
+			// :<旧模式> <新模式> <旧 hash> <新 hash> <状态>
+			raw := strings.Fields(f[i])
+			if len(raw) != 5 || i+1 >= len(f) {
+				return nil, fmt.Errorf("unexpected diff-tree output: %q", f[i])
+			}
+			c := Change{Action: raw[4][:1], Name: f[i+1]}
+			i++
+			switch c.Action {
+			case "T":
+				c.Action = "M"
+			case "R", "C":
+				if i+1 >= len(f) {
+					return nil, fmt.Errorf("unexpected diff-tree output: %q", f[i])
+				}
+				c.OldName, c.Name = c.Name, f[i+1]
+				i++
+			}
+			c.SizeDelta, err = b.sizeDelta(raw)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, c)
+			continue
+		}
+		// <增加>\t<删除>\t<路径>，重命名和复制的路径为空，后面是两个路径
+		stat := strings.SplitN(f[i], "\t", 3)
+		if len(stat) != 3 || n >= len(res) {
+			return nil, fmt.Errorf("unexpected diff-tree output: %q", f[i])
+		}
+		if stat[2] == "" {
+			i += 2
+		}
+		c := &res[n]
+		n++
+		if stat[0] == "-" {
+			c.Binary = true
+			continue
+		}
+		c.Added, _ = strconv.Atoi(stat[0])
+		c.Removed, _ = strconv.Atoi(stat[1])
+	}
+	return res, nil
+}
+
+// sizeDelta returns the size change of a --raw entry, the objects are read
+// from the repository directly.
+func (b *cliBackend) sizeDelta(raw []string) (int64, error) {
+	var size [2]int64
+	for i := range size {
+		mode, err := filemode.New(strings.TrimPrefix(raw[i], ":"))
+		if err != nil {
+			return 0, err
+		}
+		size[i], err = blobSize(b.Repository().Storer, mode, plumbing.NewHash(raw[i+2]))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size[1] - size[0], nil
+}
+
+// checkout and reset of git 2.39 reject --end-of-options, so the hash is
+// checked instead. A full hash never looks like an option.
+func (b *cliBackend) Checkout(hash string, files []string) error {
+	if !plumbing.IsHash(hash) {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+	if len(files) == 0 {
+		files = []string{"."}
+	}
+	_, err := b.run(nil, literalPaths, append([]string{"checkout", "-q", hash, "--"}, files...)...)
+	return err
+}
+
+func (b *cliBackend) Reset(hash string, files []string) error {
+	if !plumbing.IsHash(hash) {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+	if len(files) == 0 {
+		_, err := b.gitCmd(nil, "reset", "-q", "--mixed", hash)
+		return err
+	}
+	_, err := b.run(nil, literalPaths, append([]string{"reset", "-q", hash, "--"}, files...)...)
+	return err
+}
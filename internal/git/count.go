@@ -0,0 +1,97 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// maxCountWalk limits how far Total walks back to find the counted commit,
+// further away the history is counted again.
+const maxCountWalk = 1000
+
+// commitCount caches the number of commits reachable from a head.
+type commitCount struct {
+	head plumbing.Hash // 为零时还没有计数
+	n    int
+}
+
+// Total returns the number of commits reachable from HEAD. The history is
+// counted once, then commits on top of the counted head are added, so the
+// count stays cheap while commits are added by the runner or pulled.
+func (r *GitRepo) Total() (int, error) {
+	repo := r.repo()
+	if repo == nil {
+		return 0, nil
+	}
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	r.countMu.Lock()
+	defer r.countMu.Unlock()
+	c := &r.count
+	if c.head == head.Hash() {
+		return c.n, nil
+	}
+	if !c.head.IsZero() {
+		if n, ok := countSince(repo, head.Hash(), c.head); ok {
+			c.head, c.n = head.Hash(), c.n+n
+			return c.n, nil
+		}
+	}
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = iter.ForEach(func(*object.Commit) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.head, c.n = head.Hash(), n
+	return n, nil
+}
+
+// countSince counts the commits from head back to the counted commit. It
+// gives up on merges, the root and after maxCountWalk commits.
+func countSince(repo *git.Repository, head, counted plumbing.Hash) (int, bool) {
+	h := head
+	for n := 0; n < maxCountWalk; n++ {
+		if h == counted {
+			return n, true
+		}
+		c, err := repo.CommitObject(h)
+		if err != nil || c.NumParents() != 1 {
+			return 0, false
+		}
+		h = c.ParentHashes[0]
+	}
+	return 0, false
+}
+
+// counted adds a commit made on top of parent to the count.
+func (r *GitRepo) counted(parent plumbing.Hash, h string) {
+	r.countMu.Lock()
+	defer r.countMu.Unlock()
+	if !parent.IsZero() && r.count.head == parent {
+		r.count.head = plumbing.NewHash(h)
+		r.count.n++
+	}
+}
+
+// headHash returns the commit of HEAD, zero if there is none.
+func (r *GitRepo) headHash() plumbing.Hash {
+	if repo := r.repo(); repo != nil {
+		if head, err := repo.Head(); err == nil {
+			return head.Hash()
+		}
+	}
+	return plumbing.ZeroHash
+}
@@ -0,0 +1,157 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/merkletrie"
+)
+
+// DeletedFile is a file deleted by a commit that does not exist at HEAD.
+type DeletedFile struct {
+	Path      string  `json:"path"`
+	Size      int64   `json:"size"`      // 删除前的大小
+	Commit    *Commit `json:"commit"`    // 最后一次存在的提交
+	DeletedBy *Commit `json:"deletedBy"` // 删除它的提交，作者即删除者
+}
+
+// Deleted lists the files deleted by commits between since and until, zero
+// for no limit, newest first. A file deleted more than once is listed with
+// its last deletion, files that exist again at HEAD are left out.
+func (r *GitRepo) Deleted(since, until time.Time) ([]DeletedFile, error) {
+	res := []DeletedFile{}
+	err := r.deletions(since, until, func(d DeletedFile) bool {
+		res = append(res, d)
+		return true
+	})
+	return res, err
+}
+
+// RestoreDeleted restores each of paths from the last commit it existed in,
+// with the same options and results as RevertFile.
+func (r *GitRepo) RestoreDeleted(paths []string, opts RestoreOptions) ([]RestoreResult, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	pending := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		pending[strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")] = true
+	}
+	// 按最后存在的提交分组恢复
+	var hashes []string
+	files := make(map[string][]string)
+	err := r.deletions(time.Time{}, time.Time{}, func(d DeletedFile) bool {
+		if pending[d.Path] {
+			delete(pending, d.Path)
+			if files[d.Commit.Hash] == nil {
+				hashes = append(hashes, d.Commit.Hash)
+			}
+			files[d.Commit.Hash] = append(files[d.Commit.Hash], d.Path)
+		}
+		return len(pending) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []RestoreResult
+	for _, h := range hashes {
+		rs, err := r.RevertFile(h, files[h], opts)
+		res = append(res, rs...)
+		if err != nil {
+			return res, err
+		}
+	}
+	for p := range pending {
+		logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), "File is not deleted:", p)
+		res = append(res, RestoreResult{File: p, Error: "not a deleted file"})
+	}
+	return res, nil
+}
+
+// deletions walks the commits from HEAD and calls fn for the files each one
+// deleted compared to its first parent, until fn returns false.
+func (r *GitRepo) deletions(since, until time.Time, fn func(d DeletedFile) bool) error {
+	repo := r.repo()
+	if repo == nil {
+		return errors.New("repository is not opened")
+	}
+	h := r.headHash()
+	if h.IsZero() {
+		return nil
+	}
+	head, err := repo.CommitObject(h)
+	if err != nil {
+		return err
+	}
+	headTree, err := head.Tree()
+	if err != nil {
+		return err
+	}
+	opts := &git.LogOptions{From: h}
+	if !since.IsZero() {
+		opts.Since = &since
+	}
+	if !until.IsZero() {
+		opts.Until = &until
+	}
+	iter, err := repo.Log(opts)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.NumParents() == 0 {
+			return nil
+		}
+		parent, err := c.Parent(0)
+		if err != nil {
+			return err
+		}
+		from, err := parent.Tree()
+		if err != nil {
+			return err
+		}
+		to, err := c.Tree()
+		if err != nil {
+			return err
+		}
+		changes, err := object.DiffTree(from, to)
+		if err != nil {
+			return err
+		}
+		for _, ch := range changes {
+			action, err := ch.Action()
+			if err != nil {
+				return err
+			}
+			name := ch.From.Name
+			if action != merkletrie.Delete || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if _, err := headTree.FindEntry(name); err == nil {
+				continue
+			}
+			size, err := repo.Storer.EncodedObjectSize(ch.From.TreeEntry.Hash)
+			if err != nil {
+				return err
+			}
+			if !fn(DeletedFile{Path: name, Size: size, Commit: toCommit(parent), DeletedBy: toCommit(c)}) {
+				return storer.ErrStop
+			}
+		}
+		return nil
+	})
+	if err == storer.ErrStop {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+func TestDeleted(t *testing.T) {
+	r := newTestRepo(t, config.BackendGoGit, map[string]string{"a.txt": "a", "b.txt": "bb", "dir/c.txt": "ccc"})
+	root := r.RepoConfig.Path
+	c1 := head(t, r)
+	os.Remove(filepath.Join(root, "b.txt"))
+	os.RemoveAll(filepath.Join(root, "dir"))
+	r.Commit("delete b and dir")
+	c2 := head(t, r)
+	// 删除后又恢复的文件不在列表中
+	os.Remove(filepath.Join(root, "a.txt"))
+	r.Commit("delete a")
+	writeFile(t, filepath.Join(root, "a.txt"), "a")
+	r.Commit("add a")
+
+	list, err := r.Deleted(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Deleted = %+v", list)
+	}
+	sizes := map[string]int64{"b.txt": 2, "dir/c.txt": 3}
+	for _, d := range list {
+		if d.Size != sizes[d.Path] || d.Commit.Hash != c1 || d.DeletedBy.Hash != c2 || d.DeletedBy.Author != "test" {
+			t.Errorf("Deleted %+v %+v %+v", d, d.Commit, d.DeletedBy)
+		}
+	}
+	list, err = r.Deleted(time.Now().Add(time.Hour), time.Time{})
+	if err != nil || len(list) != 0 {
+		t.Errorf("Deleted in the future = %+v, %v", list, err)
+	}
+
+	res, err := r.RestoreDeleted([]string{"dir/c.txt", "a.txt"}, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].File != "dir/c.txt" || res[0].Error != "" || res[1].File != "a.txt" || res[1].Error == "" {
+		t.Errorf("RestoreDeleted = %+v", res)
+	}
+	if got := readFile(t, filepath.Join(root, "dir", "c.txt")); got != "ccc" {
+		t.Errorf("dir/c.txt = %q", got)
+	}
+}
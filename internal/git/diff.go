@@ -0,0 +1,113 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// maxLineStats is the size above which a file is not diffed and counted as
+// binary, like core.bigFileThreshold for git.
+const maxLineStats = 1 << 20
+
+// maxStatsCache limits the cached commit stats, the cache is dropped when
+// it is full.
+const maxStatsCache = 10000
+
+// CommitStats sums the changes of a commit.
+type CommitStats struct {
+	Files   int `json:"files"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// addStats sets the stats of commits. Commits never change, so the stats
+// are cached, a commit that fails is listed without stats.
+func (r *GitRepo) addStats(commits []Commit) {
+	for i := range commits {
+		h := commits[i].Hash
+		r.statsMu.Lock()
+		s, ok := r.stats[h]
+		r.statsMu.Unlock()
+		if !ok {
+			changes, err := r.backend.Diff(h)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get stats of commit:", h, "Error:", err)
+				continue
+			}
+			s.Files = len(changes)
+			for _, c := range changes {
+				s.Added += c.Added
+				s.Removed += c.Removed
+			}
+			r.statsMu.Lock()
+			if r.stats == nil || len(r.stats) >= maxStatsCache {
+				r.stats = make(map[string]CommitStats)
+			}
+			r.stats[h] = s
+			r.statsMu.Unlock()
+		}
+		commits[i].Stats = &s
+	}
+}
+
+// blobSize returns the size of the blob h with mode, 0 for no blob such as
+// a submodule.
+func blobSize(s storer.EncodedObjectStorer, mode filemode.FileMode, h plumbing.Hash) (int64, error) {
+	if h.IsZero() || !mode.IsFile() {
+		return 0, nil
+	}
+	return s.EncodedObjectSize(h)
+}
+
+// lineStats sets the lines added and removed by ch and the size delta on c.
+// Files larger than maxLineStats are not read.
+func lineStats(s storer.EncodedObjectStorer, ch *object.Change, c *Change) error {
+	from, err := blobSize(s, ch.From.TreeEntry.Mode, ch.From.TreeEntry.Hash)
+	if err != nil {
+		return err
+	}
+	to, err := blobSize(s, ch.To.TreeEntry.Mode, ch.To.TreeEntry.Hash)
+	if err != nil {
+		return err
+	}
+	c.SizeDelta = to - from
+	if from > maxLineStats || to > maxLineStats {
+		c.Binary = true
+		return nil
+	}
+	patch, err := ch.Patch()
+	if err != nil {
+		return err
+	}
+	for _, fp := range patch.FilePatches() {
+		if fp.IsBinary() {
+			c.Binary = true
+			continue
+		}
+		for _, chunk := range fp.Chunks() {
+			switch chunk.Type() {
+			case fdiff.Add:
+				c.Added += countLines(chunk.Content())
+			case fdiff.Delete:
+				c.Removed += countLines(chunk.Content())
+			}
+		}
+	}
+	return nil
+}
+
+// countLines counts the lines of s, a last line without newline included.
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
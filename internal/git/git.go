@@ -1,100 +1,86 @@
 package git
 
 import (
-	"errors"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
+	"path"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/charghet/go-sync/internal/config"
 	"github.com/charghet/go-sync/pkg/logger"
-	"github.com/charghet/go-sync/pkg/util"
 	"github.com/go-git/go-git/v6"
 	gitConfig "github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/plumbing/transport/http"
-	"github.com/go-git/go-git/v6/utils/merkletrie"
+	"github.com/go-git/go-git/v6/storage/memory"
 )
 
 type GitRepo struct {
 	RepoConfig config.RepoConfig
-	repo       *git.Repository
-	worktree   *git.Worktree
-	Auth       *http.BasicAuth
+	backend    Backend
+	countMu    sync.Mutex
+	count      commitCount
+	statsMu    sync.Mutex
+	stats      map[string]CommitStats // 按提交缓存
+	// 串行化修改仓库的操作，监听的提交和 /api/sync 等请求可能同时进行
+	writeMu sync.Mutex
 }
 
 func NewGitRepo(repoConfig config.RepoConfig) *GitRepo {
-	return &GitRepo{
-		RepoConfig: repoConfig,
-		Auth: &http.BasicAuth{
-			Username: repoConfig.Username,
-			Password: repoConfig.Password,
-		},
-	}
+	r := &GitRepo{RepoConfig: repoConfig}
+	r.backend = newBackend(&r.RepoConfig)
+	return r
 }
 
-func (r *GitRepo) Open(pull bool) error {
-	var err error
-	r.repo, err = git.PlainOpen(r.RepoConfig.Path)
+// repo reads objects and refs, nil before the repository is opened.
+func (r *GitRepo) repo() *git.Repository {
+	return r.backend.Repository()
+}
 
-	if err != nil {
-		if err == git.ErrRepositoryNotExists {
-			logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Repository does not exist, initing:", r.RepoConfig.Url)
-			r.repo, err = git.PlainInit(r.RepoConfig.Path, false)
-			if err != nil {
-				logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to init git repository:", r.RepoConfig.Path, "Error:", err)
-				return err
-			}
-			_, err = r.repo.CreateRemote(&gitConfig.RemoteConfig{
-				Name: "origin",
-				URLs: []string{r.RepoConfig.Url},
-			})
-			if err != nil {
-				logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to create remote repository:", err)
-				return err
-			}
-			logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Created remote repository 'origin' for:", r.RepoConfig.Path)
+func (r *GitRepo) signature() object.Signature {
+	return object.Signature{
+		Name:  r.RepoConfig.Username,
+		Email: r.RepoConfig.Email,
+		When:  time.Now(),
+	}
+}
 
-			err = r.repo.CreateBranch(&gitConfig.Branch{
-				Name:   r.RepoConfig.Branch,
-				Remote: "origin",
-				Merge:  plumbing.NewBranchReferenceName(r.RepoConfig.Branch),
-			})
-			if err != nil {
-				logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to create branch:", r.RepoConfig.Branch, "Error:", err)
-				return err
-			}
+func (r *GitRepo) Open(pull bool) error {
+	err := r.backend.Open()
+	if err == git.ErrRepositoryNotExists {
+		logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Repository does not exist, initing:", r.RepoConfig.Url)
+		err = r.backend.Init()
+		if err != nil {
+			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to init git repository:", r.RepoConfig.Path, "Error:", err)
+			return err
 		}
+		logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Created remote repository 'origin' for:", r.RepoConfig.Path)
 	}
 	if err != nil {
-		logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to open git repository:", err)
-		return err
-	}
-
-	r.worktree, err = r.repo.Worktree()
-	if err != nil {
-		logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get worktree:", err)
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to open git repository:", err)
 		return err
 	}
 
 	if pull {
 		err = r.Pull()
 		if err != nil {
-			logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to pull changes after init:", err)
+			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to pull changes after init:", err)
+			return err
 		}
 		c, err := r.Commit("auto commit by init in " + time.Now().Format("2006-01-02 15:04:05"))
 		if err != nil {
-			logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to commit after init:", err)
+			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to commit after init:", err)
 			return err
 		}
 
 		if c {
 			err = r.Push()
 			if err != nil {
-				logger.Fatal(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to push after init:", err)
+				logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to push after init:", err)
 				return err
 			}
 		}
@@ -103,60 +89,190 @@ func (r *GitRepo) Open(pull bool) error {
 	return nil
 }
 
-func (r *GitRepo) Clone() error {
-	var err error
-	r.repo, err = git.PlainClone(r.RepoConfig.Path, &git.CloneOptions{
-		URL:  r.RepoConfig.Url,
-		Auth: r.Auth,
+// Create sets the repository up for a new config entry. A missing or empty
+// path is cloned if the remote has the branch, anything else is opened or
+// inited like Open.
+func (r *GitRepo) Create(pull bool) error {
+	if emptyDir(r.RepoConfig.Path) {
+		branches, err := r.RemoteBranches()
+		if err != nil {
+			logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to list remote branches:", err)
+		} else if _, ok := branches[r.RepoConfig.Branch]; ok {
+			logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Cloning:", r.RepoConfig.Url)
+			return r.Clone()
+		}
+	}
+	return r.Open(pull)
+}
+
+// RemoteBranches maps the branches of the remote repository to their
+// commits, listed with the backend and credentials of the repository.
+func (r *GitRepo) RemoteBranches() (map[string]string, error) {
+	return r.backend.RemoteBranches()
+}
+
+// emptyDir reports whether p does not exist or is an empty directory.
+func emptyDir(p string) bool {
+	entries, err := os.ReadDir(p)
+	if os.IsNotExist(err) {
+		return true
+	}
+	return err == nil && len(entries) == 0
+}
+
+// LsRemote lists the branches of a remote repository, which also checks that
+// it is reachable and the credentials are accepted. An empty remote returns
+// no branches and no error.
+func LsRemote(url, username, password string) ([]string, error) {
+	refs, err := RemoteBranches(url, username, password)
+	if err != nil {
+		return nil, err
+	}
+	branches := make([]string, 0, len(refs))
+	for name := range refs {
+		branches = append(branches, name)
+	}
+	sort.Strings(branches)
+	return branches, nil
+}
+
+// RemoteBranches maps the branch names of a remote repository to their
+// commit hashes.
+func RemoteBranches(url, username, password string) (map[string]string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	refs, err := remote.List(&git.ListOptions{
+		Auth: &http.BasicAuth{
+			Username: username,
+			Password: password,
+		},
 	})
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to clone repository:", r.RepoConfig.Url)
-		return err
+		if err == transport.ErrEmptyRemoteRepository {
+			return map[string]string{}, nil
+		}
+		return nil, err
 	}
-	return nil
+	branches := make(map[string]string)
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			branches[ref.Name().Short()] = ref.Hash().String()
+		}
+	}
+	return branches, nil
 }
 
-func (r *GitRepo) Commit(message string) (commit bool, err error) {
-	_, err = r.worktree.Add(".")
+// ErrRepositoryNotExists is returned by OpenExisting if there is no
+// repository at the path.
+var ErrRepositoryNotExists = git.ErrRepositoryNotExists
+
+// OpenExisting opens the repository without creating it, unlike Open.
+func (r *GitRepo) OpenExisting() error {
+	return r.backend.Open()
+}
+
+type Tracking struct {
+	Head      string // HEAD 指向的分支
+	Hash      string // 本地分支的提交
+	Fetched   string // 上次拉取时远程分支的提交 refs/remotes/origin/<branch>
+	RemoteUrl string // origin 的地址
+	Remote    string // 分支配置的远程仓库
+	Merge     string // 分支配置的远程分支
+}
+
+func (r *GitRepo) Tracking() (Tracking, error) {
+	var t Tracking
+	head, err := r.repo().Reference(plumbing.HEAD, false)
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to add changes to worktree:", err)
+		return t, err
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		t.Head = head.Target().Short()
+	}
+	ref, err := r.repo().Reference(plumbing.NewBranchReferenceName(r.RepoConfig.Branch), true)
+	if err == nil {
+		t.Hash = ref.Hash().String()
+	} else if err != plumbing.ErrReferenceNotFound {
+		return t, err
+	}
+	if ref, err := r.repo().Reference(plumbing.NewRemoteReferenceName("origin", r.RepoConfig.Branch), true); err == nil {
+		t.Fetched = ref.Hash().String()
+	}
+	if remote, err := r.repo().Remote("origin"); err == nil && len(remote.Config().URLs) > 0 {
+		t.RemoteUrl = remote.Config().URLs[0]
+	}
+	if b, err := r.repo().Branch(r.RepoConfig.Branch); err == nil {
+		t.Remote = b.Remote
+		t.Merge = b.Merge.String()
+	}
+	return t, nil
+}
+
+type Relation int
+
+const (
+	Same     Relation = iota
+	Ahead             // 本地包含远程的提交，需要推送
+	Behind            // 远程包含本地的提交，需要拉取
+	Diverged          // 双方都有对方没有的提交
+	Unknown           // 本地没有远程的提交，需要先 fetch
+)
+
+// Relation compares the local branch with the commit of the remote branch.
+func (r *GitRepo) Relation(local, remote string) (Relation, error) {
+	if local == remote {
+		return Same, nil
+	}
+	rc, err := r.repo().CommitObject(plumbing.NewHash(remote))
+	if err == plumbing.ErrObjectNotFound {
+		return Unknown, nil
 	}
-	status, err := r.worktree.Status()
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get worktree status:", err)
-		return false, err
-	}
-	if status.IsClean() {
-		logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "No changes to commit, worktree is clean.")
-		return false, nil
-	}
-	commit = true
-	h, err := r.worktree.Commit(message, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  r.RepoConfig.Username,
-			Email: r.RepoConfig.Email,
-			When:  time.Now(),
-		},
-	})
+		return Unknown, err
+	}
+	if local == "" {
+		return Behind, nil
+	}
+	lc, err := r.repo().CommitObject(plumbing.NewHash(local))
+	if err != nil {
+		return Unknown, err
+	}
+	if ok, err := rc.IsAncestor(lc); err != nil || ok {
+		return Ahead, err
+	}
+	if ok, err := lc.IsAncestor(rc); err != nil || ok {
+		return Behind, err
+	}
+	return Diverged, nil
+}
 
+func (r *GitRepo) Clone() error {
+	err := r.backend.Clone()
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to commit changes:", err)
-		return false, err
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to clone repository:", r.RepoConfig.Url)
+		return err
 	}
-	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Committed changes:", h.String(), message)
-	return commit, nil
+	return nil
+}
+
+// Commit stages the whole worktree and commits it.
+func (r *GitRepo) Commit(message string) (commit bool, err error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.commit(message, nil)
 }
 
 func (r *GitRepo) Push() error {
-	err := r.repo.Push(&git.PushOptions{
-		RemoteName: "origin",
-		Auth:       r.Auth,
-	})
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.push()
+}
+
+func (r *GitRepo) push() error {
+	err := r.backend.Push()
 	if err != nil {
-		if err == git.NoErrAlreadyUpToDate {
-			logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "No changes to push, repository is up to date.")
-			return nil
-		}
 		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to push changes:", err)
 		return err
 	}
@@ -165,218 +281,194 @@ func (r *GitRepo) Push() error {
 }
 
 func (r *GitRepo) Pull() error {
-	err := r.worktree.Pull(&git.PullOptions{
-		RemoteName:    "origin",
-		ReferenceName: plumbing.NewBranchReferenceName(r.RepoConfig.Branch),
-		Auth:          r.Auth,
-	})
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.pull()
+}
+
+func (r *GitRepo) pull() error {
+	err := r.backend.Pull()
 	if err != nil {
-		if err == git.NoErrAlreadyUpToDate {
-			logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "No changes to pull, repository is up to date.")
-			return nil
-		}
 		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to pull changes:", err)
 		return err
 	}
 	return nil
 }
 
-func (r *GitRepo) Checkout(hash string, files []string) error {
-	err := r.worktree.Checkout(&git.CheckoutOptions{
-		Hash:                      plumbing.NewHash(hash),
-		SparseCheckoutDirectories: files,
-	})
+// Sync pulls, commits local changes and pushes, the same sequence as Open(true).
+// No other change to the repository runs in between.
+func (r *GitRepo) Sync(message string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	err := r.pull()
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to checkout:", hash, "Error:", err)
 		return err
 	}
-	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Checked out:", hash, "with files:", files)
+	c, err := r.commit(message, nil)
+	if err != nil {
+		return err
+	}
+	if c {
+		return r.push()
+	}
 	return nil
 }
 
-func (r *GitRepo) Restore(files []string) error {
-	err := r.worktree.Restore(&git.RestoreOptions{
-		Files: files,
-	})
+type Status struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Branch  string `json:"branch"`
+	Head    string `json:"head"`
+	Changes int    `json:"changes"` // 未提交的文件数
+	Error   string `json:"error,omitempty"`
+}
 
+func (r *GitRepo) Status() Status {
+	s := Status{
+		Name:   r.RepoConfig.Name,
+		Path:   r.RepoConfig.Path,
+		Branch: r.RepoConfig.Branch,
+	}
+	if r.repo() == nil {
+		s.Error = "repository is not opened"
+		return s
+	}
+	head, err := r.repo().Head()
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		s.Error = err.Error()
+		return s
+	}
+	if head != nil {
+		s.Head = head.Hash().String()
+	}
+	changes, err := r.backend.Status()
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to restore files:", files, "Error:", err)
-		return err
+		s.Error = err.Error()
+		return s
 	}
-	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Restored files:", files)
-	return nil
+	s.Changes = len(changes)
+	return s
 }
 
-func (r *GitRepo) Reset(hash string, files []string) error {
-	err := r.worktree.Reset(&git.ResetOptions{
-		Commit: plumbing.NewHash(hash),
-		Files:  files,
-	})
+// Checkout writes files, everything if empty, as of hash to the worktree and
+// the index. HEAD is not moved.
+func (r *GitRepo) Checkout(hash string, files []string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	err := r.backend.Checkout(hash, files)
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to reset to hash:", hash, "Error:", err)
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to checkout:", hash, "Error:", err)
 		return err
 	}
-	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Reset worktree to hash:", hash)
+	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Checked out:", hash, "with files:", files)
 	return nil
 }
 
-func (r *GitRepo) RevertFile(hash string, files []string) error {
-	until := time.Now()
-	cIter, err := r.repo.Log(&git.LogOptions{Until: &until})
+// Restore discards the changes of files since HEAD.
+func (r *GitRepo) Restore(files []string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	head, err := r.repo().Head()
+	if err == nil {
+		err = r.backend.Checkout(head.Hash().String(), files)
+	}
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get commit iterator:", err)
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to restore files:", files, "Error:", err)
 		return err
 	}
+	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Restored files:", files)
+	return nil
+}
 
-	rct := plumbing.NewHash(hash)
-
-	foundHash := false
-	err = cIter.ForEach(func(c *object.Commit) error {
-		if c.Hash == rct {
-			foundHash = true
-			fi, err := c.Files()
-			if err != nil {
-				logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get files from commit:", c.Hash, "Error:", err)
-				return err
-			}
-			fileSet := util.SliceToSet(files)
-			_, all := fileSet["."]
-			err = fi.ForEach(func(cf *object.File) error {
-				if _, e := fileSet[cf.Name]; all || e {
-					delete(fileSet, cf.Name)
-					fr, err := cf.Blob.Reader()
-					if err != nil {
-						logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get file reader for:", cf.Name, "Error:", err)
-						return err
-					}
-					fw, err := os.Create(filepath.Join(r.RepoConfig.Path, cf.Name))
-					if err != nil {
-						logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to create file:", cf.Name, "Error:", err)
-						return err
-					}
-					io.Copy(fw, fr)
-					logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Reverted file:", cf.Name, "to commit:", c.Hash)
-				}
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-			if !all && len(fileSet) > 0 {
-				s := fmt.Sprintf("Some files were not found in commit:%v Files not found:%v", c.Hash, fileSet)
-				logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), s)
-				return errors.New(s)
-			}
-		}
-		return nil
-	})
+// Reset moves HEAD to hash and resets the index, or only resets the index
+// entries of files if given.
+func (r *GitRepo) Reset(hash string, files []string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	err := r.backend.Reset(hash, files)
 	if err != nil {
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to reset to hash:", hash, "Error:", err)
 		return err
 	}
-	if !foundHash {
-		s := fmt.Sprintf("Commit hash not found:%v", hash)
-		logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), s)
-		return errors.New(s)
-	}
+	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Reset worktree to hash:", hash)
 	return nil
 }
 
 type Commit struct {
-	Hash    string `json:"hash"`
-	Message string `json:"message"`
-	Author  string `json:"author"`
-	Date    string `json:"date"`
-	Email   string `json:"email"`
+	Hash    string       `json:"hash"`
+	Message string       `json:"message"`
+	Author  string       `json:"author"`
+	Date    string       `json:"date"`
+	Email   string       `json:"email"`
+	Stats   *CommitStats `json:"stats,omitempty"` // 只有 Commits 返回
 }
 
+// GetCommit returns a page of the history and the total number of commits,
+// pageIndex 0 returns every commit. Only the commits up to the page are read,
+// prefer Commits with a cursor for later pages.
 func (r *GitRepo) GetCommit(pageIndex, pageSize int) (commits []Commit, total int, err error) {
-	until := time.Now()
-	cIter, err := r.repo.Log(&git.LogOptions{Until: &until})
+	if pageIndex == 0 {
+		commits, err = r.backend.Log(LogOptions{})
+	} else {
+		commits, _, err = r.Commits(CommitQuery{}, "", max((pageIndex-1)*pageSize, 0), pageSize)
+	}
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get commit iterator:", err)
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get commits:", err)
+		return nil, 0, err
+	}
+	total, err = r.Total()
+	if err != nil {
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to count commits:", err)
 		return nil, 0, err
 	}
-
-	start := (pageIndex - 1) * pageSize
-	end := pageIndex * pageSize
-	cIter.ForEach(func(c *object.Commit) error {
-		total += 1
-		if pageIndex == 0 || (total > start && total <= end) {
-			commits = append(commits, Commit{
-				Hash:    c.Hash.String(),
-				Message: c.Message,
-				Author:  c.Author.Name,
-				Date:    c.Author.When.Format("2006-01-02 15:04:05"),
-				Email:   c.Author.Email,
-			})
-		}
-		return nil
-	})
 	return commits, total, nil
 }
 
-type Change struct {
-	Action string `json:"action"`
-	Name   string `json:"name"`
-}
-
-func (r *GitRepo) GetChange(hash string) ([]Change, error) {
-	commitHash := plumbing.NewHash(hash)
-	commit, err := r.repo.CommitObject(commitHash)
-	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get commit:", err)
-		return nil, err
+// Commits returns up to n commits matching q starting at cursor, HEAD if
+// empty, after skipping the first skip of them. next is the cursor of the
+// following page, empty on the last page. The history is walked from the
+// cursor, so a page stays the same when new commits are added on top.
+func (r *GitRepo) Commits(q CommitQuery, cursor string, skip, n int) (commits []Commit, next string, err error) {
+	if n <= 0 {
+		return nil, "", nil
 	}
-
-	parentCommit, err := commit.Parents().Next()
-	if err != nil {
-		if err != io.EOF {
-			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get parent commit:", err)
-			return nil, err
-		}
+	if cursor != "" && !plumbing.IsHash(cursor) {
+		return nil, "", fmt.Errorf("invalid cursor: %s", cursor)
 	}
-
-	var commitTree, parentTree *object.Tree
-	if parentCommit == nil {
-		parentTree = &object.Tree{}
-	} else {
-		parentTree, err = parentCommit.Tree()
-		if err != nil {
-			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get parent commit tree:", err)
-			return nil, err
-		}
+	if _, err := path.Match(q.Path, ""); err != nil {
+		return nil, "", fmt.Errorf("invalid path pattern: %s", q.Path)
 	}
-	commitTree, err = commit.Tree()
+	commits, err = r.backend.Log(LogOptions{From: cursor, Limit: skip + n + 1, CommitQuery: q})
 	if err != nil {
-		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get commit tree:", err)
-		return nil, err
+		return nil, "", err
+	}
+	if len(commits) > skip+n {
+		next = commits[skip+n].Hash
 	}
+	commits = commits[min(skip, len(commits)):min(skip+n, len(commits))]
+	r.addStats(commits)
+	return commits, next, nil
+}
 
-	changes, err := parentTree.Diff(commitTree)
+type Change struct {
+	Action  string `json:"action"`            // A M D，R 为重命名，C 为复制
+	Name    string `json:"name"`              // 提交后的路径，删除时为原路径
+	OldName string `json:"oldName,omitempty"` // R 和 C 的原路径
+	Added   int    `json:"added"`             // 增加的行数
+	Removed int    `json:"removed"`           // 删除的行数
+	Binary  bool   `json:"binary"`            // 二进制文件没有行数
+	// 文件大小的变化，单位字节
+	SizeDelta int64 `json:"sizeDelta"`
+}
+
+func (r *GitRepo) GetChange(hash string) ([]Change, error) {
+	if !plumbing.IsHash(hash) {
+		return nil, fmt.Errorf("invalid hash: %s", hash)
+	}
+	changes, err := r.backend.Diff(hash)
 	if err != nil {
 		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get changes:", err)
 		return nil, err
 	}
-	res := make([]Change, changes.Len())
-	for i, change := range changes {
-		action, err := change.Action()
-		if err != nil {
-			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to get action:", err)
-			return nil, err
-		}
-		var c Change
-		switch action {
-		case merkletrie.Insert:
-			c.Action = "A"
-			c.Name = change.To.Name
-		case merkletrie.Modify:
-			c.Action = "M"
-			c.Name = change.To.Name
-		case merkletrie.Delete:
-			c.Action = "D"
-			c.Name = change.From.Name
-		}
-		res[i] = c
-	}
-	return res, nil
+	return changes, nil
 }
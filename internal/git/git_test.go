@@ -38,7 +38,7 @@ func TestRevertFile(t *testing.T) {
 	}
 	h := "50f2c8891ad7d9cc0af6690ae0539aab160b99be"
 	files := []string{"."}
-	err = r.RevertFile(h, files)
+	_, err = r.RevertFile(h, files, RestoreOptions{})
 	if err != nil {
 		t.Fatalf("Failed to revert file: %v", err)
 		return
@@ -0,0 +1,485 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/go-git/go-git/v6"
+	gitConfig "github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/http"
+	"github.com/go-git/go-git/v6/utils/merkletrie"
+)
+
+// goGitBackend runs git in process with go-git.
+type goGitBackend struct {
+	rc       *config.RepoConfig
+	repo     *git.Repository
+	worktree *git.Worktree
+	ignore   gitignore.Matcher // Add 使用的 .gitignore 缓存
+	// 读取 ignore 时 .git/info/exclude 的修改时间
+	excludeMod time.Time
+}
+
+func (b *goGitBackend) auth() transport.AuthMethod {
+	if b.rc.Username == "" && b.rc.Password == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: b.rc.Username, Password: b.rc.Password}
+}
+
+// root is the absolute worktree, go-git fails to stage files when the
+// repository is opened with a relative path.
+func (b *goGitBackend) root() string {
+	if p, err := filepath.Abs(b.rc.Path); err == nil {
+		return p
+	}
+	return b.rc.Path
+}
+
+func (b *goGitBackend) Repository() *git.Repository {
+	return b.repo
+}
+
+func (b *goGitBackend) Open() error {
+	repo, err := git.PlainOpen(b.root())
+	if err != nil {
+		return err
+	}
+	return b.setRepo(repo)
+}
+
+func (b *goGitBackend) setRepo(repo *git.Repository) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	b.repo, b.worktree, b.ignore = repo, worktree, nil
+	return nil
+}
+
+func (b *goGitBackend) Init() error {
+	repo, err := git.PlainInit(b.root(), false, git.WithDefaultBranch(plumbing.NewBranchReferenceName(b.rc.Branch)))
+	if err != nil {
+		return err
+	}
+	_, err = repo.CreateRemote(&gitConfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{b.rc.Url},
+	})
+	if err != nil {
+		return fmt.Errorf("create remote: %w", err)
+	}
+	err = repo.CreateBranch(&gitConfig.Branch{
+		Name:   b.rc.Branch,
+		Remote: "origin",
+		Merge:  plumbing.NewBranchReferenceName(b.rc.Branch),
+	})
+	if err != nil {
+		return fmt.Errorf("create branch %s: %w", b.rc.Branch, err)
+	}
+	return b.setRepo(repo)
+}
+
+func (b *goGitBackend) Clone() error {
+	repo, err := git.PlainClone(b.root(), &git.CloneOptions{
+		URL:           b.rc.Url,
+		Auth:          b.auth(),
+		ReferenceName: plumbing.NewBranchReferenceName(b.rc.Branch),
+	})
+	if err != nil {
+		return err
+	}
+	return b.setRepo(repo)
+}
+
+func (b *goGitBackend) Add(paths []string) error {
+	if paths == nil {
+		b.ignore = nil
+		_, err := b.worktree.Add(".")
+		return err
+	}
+	// 恢复的副本会加入 .git/info/exclude
+	var mod time.Time
+	if info, err := os.Stat(filepath.Join(b.rc.Path, filepath.FromSlash(infoExclude))); err == nil {
+		mod = info.ModTime()
+	}
+	if !mod.Equal(b.excludeMod) {
+		b.ignore, b.excludeMod = nil, mod
+	}
+	var deleted []string
+	for _, rel := range paths {
+		if filepath.Base(rel) == ".gitignore" {
+			b.ignore = nil
+		}
+		p := filepath.Join(b.rc.Path, filepath.FromSlash(rel))
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			deleted = append(deleted, rel)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			err = b.add(rel)
+		} else {
+			// 新建或移入的目录，之前没有收到其中文件的事件
+			err = filepath.WalkDir(p, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				rel, err := filepath.Rel(b.rc.Path, p)
+				if err != nil {
+					return err
+				}
+				rel = filepath.ToSlash(rel)
+				if d.IsDir() {
+					if d.Name() == ".git" || b.ignored(rel, true) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				return b.add(rel)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return b.remove(deleted)
+}
+
+func (b *goGitBackend) add(rel string) error {
+	if b.ignored(rel, false) {
+		return nil
+	}
+	// SkipStatus 避免遍历整个工作区，忽略的文件已在上面排除
+	return b.worktree.AddWithOptions(&git.AddOptions{Path: rel, SkipStatus: true})
+}
+
+// remove drops deleted files, and everything below deleted directories, from
+// the index.
+func (b *goGitBackend) remove(deleted []string) error {
+	if len(deleted) == 0 {
+		return nil
+	}
+	idx, err := b.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	n := len(idx.Entries)
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if !under(e.Name, deleted) {
+			entries = append(entries, e)
+		}
+	}
+	idx.Entries = entries
+	if len(entries) == n {
+		return nil
+	}
+	return b.repo.Storer.SetIndex(idx)
+}
+
+func under(name string, dirs []string) bool {
+	for _, d := range dirs {
+		if name == d || strings.HasPrefix(name, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored checks rel and every parent directory against the .gitignore
+// files, which are read once and again after a .gitignore changed.
+func (b *goGitBackend) ignored(rel string, isDir bool) bool {
+	if b.ignore == nil {
+		patterns, err := gitignore.ReadPatterns(b.worktree.Filesystem, nil)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("[%v]", b.rc.Name), "Failed to read .gitignore:", err)
+		}
+		b.ignore = gitignore.NewMatcher(append(patterns, b.worktree.Excludes...))
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i <= len(parts); i++ {
+		if b.ignore.Match(parts[:i], i < len(parts) || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *goGitBackend) Status() ([]string, error) {
+	status, err := b.worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for p, fs := range status {
+		if fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func (b *goGitBackend) Commit(message string, author object.Signature) (string, error) {
+	h, err := b.worktree.Commit(message, &git.CommitOptions{Author: &author})
+	if errors.Is(err, git.ErrEmptyCommit) {
+		return "", ErrNothingToCommit
+	}
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+func (b *goGitBackend) Push() error {
+	err := b.repo.Push(&git.PushOptions{
+		RemoteName: "origin",
+		Auth:       b.auth(),
+	})
+	if err == git.NoErrAlreadyUpToDate {
+		logger.Info(fmt.Sprintf("[%v]", b.rc.Name), "No changes to push, repository is up to date.")
+		return nil
+	}
+	return err
+}
+
+func (b *goGitBackend) Pull() error {
+	err := b.worktree.Pull(&git.PullOptions{
+		RemoteName:    "origin",
+		ReferenceName: plumbing.NewBranchReferenceName(b.rc.Branch),
+		Auth:          b.auth(),
+	})
+	if err == git.NoErrAlreadyUpToDate {
+		logger.Info(fmt.Sprintf("[%v]", b.rc.Name), "No changes to pull, repository is up to date.")
+		return nil
+	}
+	if err == transport.ErrEmptyRemoteRepository || err == plumbing.ErrReferenceNotFound {
+		logger.Info(fmt.Sprintf("[%v]", b.rc.Name), "Nothing to pull, remote branch does not exist yet:", b.rc.Branch)
+		return nil
+	}
+	return err
+}
+
+func (b *goGitBackend) RemoteBranches() (map[string]string, error) {
+	return RemoteBranches(b.rc.Url, b.rc.Username, b.rc.Password)
+}
+
+func (b *goGitBackend) Log(opts LogOptions) ([]Commit, error) {
+	logOpts := &git.LogOptions{}
+	if opts.From != "" {
+		logOpts.From = plumbing.NewHash(opts.From)
+	}
+	if !opts.Since.IsZero() {
+		logOpts.Since = &opts.Since
+	}
+	if !opts.Until.IsZero() {
+		logOpts.Until = &opts.Until
+	}
+	if opts.Path != "" {
+		logOpts.PathFilter = func(name string) bool {
+			return matchPath(opts.Path, name)
+		}
+	}
+	author := strings.ToLower(opts.Author)
+	message := strings.ToLower(opts.Message)
+	cIter, err := b.repo.Log(logOpts)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer cIter.Close()
+	var commits []Commit
+	err = cIter.ForEach(func(c *object.Commit) error {
+		if opts.Limit > 0 && len(commits) >= opts.Limit {
+			return storer.ErrStop
+		}
+		// 与 git log --author 一样匹配 "名字 <邮箱>"
+		if author != "" && !strings.Contains(strings.ToLower(c.Author.String()), author) {
+			return nil
+		}
+		if message != "" && !strings.Contains(strings.ToLower(c.Message), message) {
+			return nil
+		}
+		commits = append(commits, *toCommit(c))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+func (b *goGitBackend) Diff(hash string) ([]Change, error) {
+	commit, err := b.repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, err
+	}
+	parentTree := &object.Tree{}
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, commitTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := copySources(changes)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Change, changes.Len())
+	for i, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		var c Change
+		switch {
+		case action == merkletrie.Insert:
+			c.Action = "A"
+			c.Name = change.To.Name
+			if from, ok := sources[change.To.TreeEntry.Hash]; ok && change.To.TreeEntry.Mode.IsFile() {
+				c.Action = "C"
+				c.OldName = from.Name
+				change = &object.Change{From: from, To: change.To}
+			}
+		case action == merkletrie.Delete:
+			c.Action = "D"
+			c.Name = change.From.Name
+		case change.From.Name != change.To.Name:
+			c.Action = "R"
+			c.Name = change.To.Name
+			c.OldName = change.From.Name
+		default:
+			c.Action = "M"
+			c.Name = change.To.Name
+		}
+		err = lineStats(b.repo.Storer, change, &c)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = c
+	}
+	return res, nil
+}
+
+// emptyBlob is not taken as the source of a copy.
+var emptyBlob = plumbing.ComputeHash(plumbing.BlobObject, nil)
+
+// copySources indexes the old content of the files modified by changes,
+// which like for git -C are the only sources of a copy. go-git only detects
+// renames, so copies are found when the content is exactly the same.
+func copySources(changes object.Changes) (map[plumbing.Hash]object.ChangeEntry, error) {
+	res := make(map[plumbing.Hash]object.ChangeEntry)
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+		e := ch.From.TreeEntry
+		if action != merkletrie.Modify || !e.Mode.IsFile() || e.Hash == emptyBlob {
+			continue
+		}
+		if _, ok := res[e.Hash]; !ok {
+			res[e.Hash] = ch.From
+		}
+	}
+	return res, nil
+}
+
+func (b *goGitBackend) Checkout(hash string, files []string) error {
+	return b.resetFiles(hash, files, git.HardReset)
+}
+
+func (b *goGitBackend) Reset(hash string, files []string) error {
+	if len(files) == 0 {
+		return b.worktree.Reset(&git.ResetOptions{Commit: plumbing.NewHash(hash), Mode: git.MixedReset})
+	}
+	return b.resetFiles(hash, files, git.MixedReset)
+}
+
+// resetFiles resets files, and everything below directories, to hash
+// without moving HEAD. go-git only resets exact file names and always moves
+// HEAD, so the names are expanded first and HEAD is set back afterwards.
+func (b *goGitBackend) resetFiles(hash string, files []string, mode git.ResetMode) error {
+	commit, err := b.repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	all := len(files) == 0
+	for _, f := range files {
+		all = all || f == "." || f == ""
+	}
+	var names []string
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if all || under(f.Name, files) {
+			names = append(names, f.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 与 git checkout <hash> -- <files> 一样，checkout 不删除文件，reset 删除索引中多出的条目
+	if mode == git.MixedReset {
+		idx, err := b.repo.Storer.Index()
+		if err != nil {
+			return err
+		}
+		for _, e := range idx.Entries {
+			if all || under(e.Name, files) {
+				names = append(names, e.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	head, err := b.repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return err
+	}
+	old, err := b.repo.Reference(plumbing.HEAD, true)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+	err = b.worktree.Reset(&git.ResetOptions{Commit: commit.Hash, Files: names, Mode: mode})
+	if old != nil {
+		return errors.Join(err, b.repo.Storer.SetReference(plumbing.NewHashReference(old.Name(), old.Hash())))
+	}
+	// 还没有提交时 HEAD 指向的分支原本不存在
+	return errors.Join(err, b.repo.Storer.RemoveReference(head.Target()))
+}
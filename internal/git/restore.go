@@ -0,0 +1,293 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// RestoreOptions chooses where RevertFile writes the files, by default over
+// the files in the worktree.
+type RestoreOptions struct {
+	// 写入的目录，保留文件在仓库中的路径，相对路径基于仓库目录
+	Dir string `json:"dir"`
+	// 写到 <name>.restored-<hash>，便于和当前版本对照
+	Suffix bool `json:"suffix"`
+	// 写在仓库内的副本默认加入 .git/info/exclude 不会自动提交，为 true 时照常提交
+	Commit bool `json:"commit"`
+}
+
+// IsZero reports whether files are restored over the worktree.
+func (o RestoreOptions) IsZero() bool {
+	return o == RestoreOptions{}
+}
+
+// target returns where the file name of commit is restored.
+func (o RestoreOptions) target(root, name string, commit plumbing.Hash) string {
+	p := filepath.FromSlash(name)
+	if o.Suffix {
+		p += ".restored-" + commit.String()[:7]
+	}
+	return filepath.Join(o.base(root), p)
+}
+
+// RestoreResult is the outcome of restoring one file.
+type RestoreResult struct {
+	File  string `json:"file"`            // 提交中的路径
+	Path  string `json:"path,omitempty"`  // 写入的位置
+	Error string `json:"error,omitempty"` // 为空时成功
+}
+
+// RevertFile writes files as they were in the commit hash to the target
+// chosen by opts. Files may be directories, "." restores the whole commit.
+// Each file is written to a temp file and renamed into place, never through
+// a symlink and never outside the target directory. A file that fails does
+// not stop the others, its error is in the result. Copies inside the
+// worktree are excluded from commits unless opts.Commit is set.
+func (r *GitRepo) RevertFile(hash string, files []string, opts RestoreOptions) ([]RestoreResult, error) {
+	repo := r.repo()
+	if repo == nil {
+		return nil, errors.New("repository is not opened")
+	}
+	if !plumbing.IsHash(hash) {
+		return nil, fmt.Errorf("invalid hash: %s", hash)
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		s := fmt.Sprintf("Commit hash not found:%v", hash)
+		logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), s)
+		return nil, errors.New(s)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(r.RepoConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+	base := opts.base(root)
+	if rel, err := filepath.Rel(root, base); err == nil && strings.EqualFold(strings.Split(rel, string(filepath.Separator))[0], ".git") {
+		return nil, errors.New("cannot restore into .git")
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	var res []RestoreResult
+	var names []string // 要恢复的路径，为空时恢复全部
+	found := make(map[string]bool)
+	for _, f := range files {
+		name := strings.Trim(path.Clean("/"+filepath.ToSlash(f)), "/")
+		if name == "" {
+			names = nil
+			break
+		}
+		if _, ok := found[name]; !ok {
+			names = append(names, name)
+			found[name] = false
+		}
+	}
+	var copies []string // 写在仓库内的副本
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if names != nil && !under(f.Name, names) {
+			return nil
+		}
+		for _, n := range names {
+			if under(f.Name, []string{n}) {
+				found[n] = true
+			}
+		}
+		target := opts.target(root, f.Name, commit.Hash)
+		result := RestoreResult{File: f.Name, Path: target}
+		err := restoreFile(base, target, f)
+		if err != nil {
+			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to restore file:", f.Name, "Error:", err)
+			result.Error = err.Error()
+		} else {
+			if rel, ok := relPath(root, target); ok && !opts.IsZero() {
+				copies = append(copies, filepath.ToSlash(rel))
+			}
+			logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Reverted file:", f.Name, "to commit:", commit.Hash, "at:", target)
+		}
+		res = append(res, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		if !found[n] {
+			logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), "File not found in commit:", commit.Hash, n)
+			res = append(res, RestoreResult{File: n, Error: "not found in commit"})
+		}
+	}
+	if len(copies) > 0 {
+		err = r.exclude(copies, opts.Commit)
+		if err != nil {
+			logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to update", infoExclude, "Error:", err)
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// base returns the directory files are restored below.
+func (o RestoreOptions) base(root string) string {
+	if o.Dir == "" {
+		return root
+	}
+	if !filepath.IsAbs(o.Dir) {
+		return filepath.Join(root, o.Dir)
+	}
+	return filepath.Clean(o.Dir)
+}
+
+// restoreFile writes f to target below base. Missing directories are
+// created, existing ones must not be symlinks, so nothing is written outside
+// of base. The file is written next to target and renamed over it, which
+// replaces a symlink at target instead of following it.
+func restoreFile(base, target string, f *object.File) error {
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of %s", target, base)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if strings.EqualFold(parts[0], ".git") {
+		return errors.New("cannot write into .git")
+	}
+	dir := base
+	for _, p := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, p)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			err = os.Mkdir(dir, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", dir)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", target)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".go-sync-restore-*")
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	err = writeTemp(tmp, f)
+	if err == nil && f.Mode == filemode.Symlink {
+		// 链接本身也要先写到临时位置再替换
+		var link string
+		link, err = f.Contents()
+		if err == nil {
+			os.Remove(name)
+			err = os.Symlink(link, name)
+		}
+	}
+	if err == nil {
+		err = os.Rename(name, target)
+	}
+	if err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// writeTemp copies the content of f to tmp with the mode of f and closes it.
+func writeTemp(tmp *os.File, f *object.File) error {
+	if f.Mode == filemode.Symlink {
+		return tmp.Close()
+	}
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+	err := copyBlob(tmp, f)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	return errors.Join(err, tmp.Close())
+}
+
+const infoExclude = ".git/info/exclude"
+
+// exclude adds the slash separated paths to .git/info/exclude, so they are
+// not committed, or removes them again if include is set. Other lines are
+// kept as they are.
+func (r *GitRepo) exclude(paths []string, include bool) error {
+	p := filepath.Join(r.RepoConfig.Path, filepath.FromSlash(infoExclude))
+	b, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(b) == 0 {
+		lines = nil
+	}
+	patterns := make(map[string]bool, len(paths))
+	for _, name := range paths {
+		patterns[excludePattern(name)] = true
+	}
+	res := lines[:0:0]
+	for _, l := range lines {
+		if patterns[l] {
+			if include {
+				continue
+			}
+			delete(patterns, l)
+		}
+		res = append(res, l)
+	}
+	if !include {
+		for _, name := range paths {
+			if l := excludePattern(name); patterns[l] {
+				delete(patterns, l)
+				res = append(res, l)
+			}
+		}
+	}
+	if len(res) == len(lines) {
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(strings.Join(res, "\n")+"\n"), 0644)
+}
+
+// excludePattern matches exactly the slash separated path name.
+func excludePattern(name string) string {
+	var sb strings.Builder
+	sb.WriteByte('/')
+	for _, c := range name {
+		if strings.ContainsRune(`\*?[`, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
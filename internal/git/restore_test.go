@@ -0,0 +1,131 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+func TestRevertFileTarget(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		r := newTestRepo(t, backend, map[string]string{"a.txt": "a1", "dir/b.txt": "b1"})
+		c1 := head(t, r)
+		writeFile(t, filepath.Join(r.RepoConfig.Path, "a.txt"), "a2")
+		r.Commit("change a")
+		c2 := head(t, r)
+		copyName := "a.txt.restored-" + c1[:7]
+
+		_, err := r.RevertFile(c1, []string{"a.txt"}, RestoreOptions{Suffix: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, filepath.Join(r.RepoConfig.Path, copyName)); got != "a1" {
+			t.Errorf("copy = %q, want a1", got)
+		}
+		if got := readFile(t, filepath.Join(r.RepoConfig.Path, "a.txt")); got != "a2" {
+			t.Errorf("a.txt = %q, want it unchanged", got)
+		}
+		// 副本不会被提交
+		ok, err := r.CommitPaths("copy", []string{copyName})
+		if err != nil || ok {
+			t.Errorf("CommitPaths(copy) = %v, %v, want nothing to commit", ok, err)
+		}
+		ok, err = r.Commit("copy")
+		if err != nil || ok || head(t, r) != c2 {
+			t.Errorf("Commit(copy) = %v, %v, want nothing to commit", ok, err)
+		}
+
+		dir := t.TempDir()
+		_, err = r.RevertFile(c1, []string{"."}, RestoreOptions{Dir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, b := readFile(t, filepath.Join(dir, "a.txt")), readFile(t, filepath.Join(dir, "dir", "b.txt")); a != "a1" || b != "b1" {
+			t.Errorf("dir: a.txt = %q, dir/b.txt = %q", a, b)
+		}
+
+		_, err = r.RevertFile(c1, []string{"a.txt"}, RestoreOptions{Suffix: true, Commit: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err = r.CommitPaths("copy", []string{copyName})
+		if err != nil || !ok {
+			t.Errorf("CommitPaths(copy) with Commit = %v, %v, want a commit", ok, err)
+		}
+	})
+}
+
+func TestExcludePattern(t *testing.T) {
+	tests := map[string]string{
+		"a.txt":        "/a.txt",
+		"dir/[x]*?.md": `/dir/\[x]\*\?.md`,
+		`a\b`:          `/a\\b`,
+	}
+	for name, want := range tests {
+		if got := excludePattern(name); got != want {
+			t.Errorf("excludePattern(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRevertFileSafe(t *testing.T) {
+	r := newTestRepo(t, config.BackendGoGit, map[string]string{"a.txt": "a", "dir/b.txt": "b", "deep/sub/c.txt": "c"})
+	root := r.RepoConfig.Path
+	writeFile(t, filepath.Join(root, "run.sh"), "#!/bin/sh\n")
+	os.Chmod(filepath.Join(root, "run.sh"), 0755)
+	r.Commit("add run.sh")
+	h := head(t, r)
+
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "a.txt"), "outside")
+	// 工作区里指向仓库外的链接
+	os.Remove(filepath.Join(root, "a.txt"))
+	os.Symlink(filepath.Join(outside, "a.txt"), filepath.Join(root, "a.txt"))
+	os.RemoveAll(filepath.Join(root, "dir"))
+	os.Symlink(outside, filepath.Join(root, "dir"))
+	os.RemoveAll(filepath.Join(root, "deep"))
+	os.Chmod(filepath.Join(root, "run.sh"), 0644)
+
+	res, err := r.RevertFile(h, []string{"a.txt", "dir", "deep", "run.sh", "missing"}, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := map[string]string{}
+	for _, x := range res {
+		errs[x.File] = x.Error
+	}
+	if len(res) != 5 || errs["a.txt"] != "" || errs["deep/sub/c.txt"] != "" || errs["run.sh"] != "" || errs["dir/b.txt"] == "" || errs["missing"] == "" {
+		t.Errorf("results = %+v", res)
+	}
+	if got := readFile(t, filepath.Join(outside, "a.txt")); got != "outside" {
+		t.Errorf("wrote through symlink: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "b.txt")); err == nil {
+		t.Error("wrote through symlinked directory")
+	}
+	info, err := os.Lstat(filepath.Join(root, "a.txt"))
+	if err != nil || !info.Mode().IsRegular() || readFile(t, filepath.Join(root, "a.txt")) != "a" {
+		t.Errorf("a.txt not replaced: %v %v", info, err)
+	}
+	if got := readFile(t, filepath.Join(root, "deep", "sub", "c.txt")); got != "c" {
+		t.Errorf("deep/sub/c.txt = %q", got)
+	}
+	info, err = os.Stat(filepath.Join(root, "run.sh"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("run.sh mode = %v, %v", info, err)
+	}
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".go-sync-restore-") {
+			t.Errorf("temp file left: %s", e.Name())
+		}
+	}
+
+	_, err = r.RevertFile(h, []string{"."}, RestoreOptions{Dir: ".git/x"})
+	if err == nil {
+		t.Error("restore into .git: no error")
+	}
+}
@@ -0,0 +1,70 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charghet/go-sync/pkg/logger"
+)
+
+// CommitPaths stages only the given paths and commits them. Paths are
+// absolute or relative to the repository, deleted files and directories are
+// removed from the index. Unlike Commit it does not hash the whole tree, but
+// it misses changes nobody reported, so Commit should still run from time to
+// time.
+func (r *GitRepo) CommitPaths(message string, paths []string) (bool, error) {
+	root, err := filepath.Abs(r.RepoConfig.Path)
+	if err != nil {
+		return false, err
+	}
+	rels := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if rel, ok := relPath(root, p); ok {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	}
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.commit(message, rels)
+}
+
+// commit stages paths, nil for the whole worktree, and commits them. The
+// caller holds writeMu.
+func (r *GitRepo) commit(message string, paths []string) (bool, error) {
+	err := r.backend.Add(paths)
+	if err != nil {
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to add changes to worktree:", err)
+		return false, err
+	}
+	parent := r.headHash()
+	h, err := r.backend.Commit(message, r.signature())
+	if errors.Is(err, ErrNothingToCommit) {
+		logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "No changes to commit, worktree is clean.")
+		return false, nil
+	}
+	if err != nil {
+		logger.Danger(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to commit changes:", err)
+		return false, err
+	}
+	r.counted(parent, h)
+	logger.Info(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Committed changes:", h, message)
+	return true, nil
+}
+
+// relPath returns p relative to root, false if p is root, outside of it or
+// inside .git.
+func relPath(root, p string) (string, bool) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == ".git" || strings.HasPrefix(rel, ".git"+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+func TestCommitPaths(t *testing.T) {
+	eachBackend(t, testCommitPaths)
+}
+
+func testCommitPaths(t *testing.T, backend string) {
+	r := newTestRepo(t, backend, map[string]string{
+		".gitignore": "*.log\n",
+		"a.txt":      "a",
+		"dir/b.txt":  "b",
+		"dir/c.txt":  "c",
+	})
+	dir := r.RepoConfig.Path
+	writeFile(t, filepath.Join(dir, "a.txt"), "a2")
+	writeFile(t, filepath.Join(dir, "new/d.txt"), "d")
+	writeFile(t, filepath.Join(dir, "new/e.log"), "e")
+	writeFile(t, filepath.Join(dir, "x.log"), "x")
+	writeFile(t, filepath.Join(dir, "untouched.txt"), "u")
+	os.RemoveAll(filepath.Join(dir, "dir"))
+
+	c, err := r.CommitPaths("paths", []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "new"),
+		"x.log",
+		filepath.Join(dir, "dir"),
+		filepath.Join(dir, ".git", "index"),
+		"/elsewhere/f.txt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c {
+		t.Fatal("expected a commit")
+	}
+
+	idx, err := r.repo().Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range idx.Entries {
+		names = append(names, e.Name)
+	}
+	want := []string{".gitignore", "a.txt", "new/d.txt"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("index = %v, want %v", names, want)
+	}
+
+	c, err = r.CommitPaths("again", []string{filepath.Join(dir, "a.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c {
+		t.Error("expected no commit without changes")
+	}
+}
+
+// BenchmarkCommit compares staging the whole tree with staging the one file
+// that changed.
+func BenchmarkCommit(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		files := make(map[string]string, n)
+		for i := 0; i < n; i++ {
+			files[fmt.Sprintf("d%03d/f%05d.txt", i%100, i)] = fmt.Sprint("file ", i)
+		}
+		r := newTestRepo(b, config.BackendGoGit, files)
+		p := filepath.Join(r.RepoConfig.Path, "d000", "f00000.txt")
+
+		b.Run(fmt.Sprintf("full/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				writeFile(b, p, fmt.Sprint("full ", i, " of ", b.N))
+				_, err := r.Commit("bench")
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("paths/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				writeFile(b, p, fmt.Sprint("paths ", i, " of ", b.N))
+				_, err := r.CommitPaths("bench", []string{p})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitPathsRelative(t *testing.T) {
+	eachBackend(t, func(t *testing.T, backend string) {
+		dir := t.TempDir()
+		t.Chdir(dir)
+		r := newEmptyRepo(t, backend, "repo", t.TempDir())
+		writeFile(t, filepath.Join(dir, "repo", "a.txt"), "a")
+		// 事件的路径是绝对路径
+		c, err := r.CommitPaths("relative", []string{filepath.Join(dir, "repo", "a.txt")})
+		if err != nil || !c {
+			t.Fatalf("CommitPaths = %v, %v, want a commit", c, err)
+		}
+		if s := status(t, r); len(s) != 0 {
+			t.Errorf("status = %v", s)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// maxTreeWalk limits how many commits Tree walks back to find the last
+// commit of each entry, older entries are returned without it.
+const maxTreeWalk = 10000
+
+type TreeEntry struct {
+	Name   string  `json:"name"`
+	Path   string  `json:"path"`
+	Type   string  `json:"type"` // dir file symlink submodule
+	Mode   string  `json:"mode"` // 八进制，如 100644
+	Size   int64   `json:"size"` // 文件大小，目录为 0
+	Commit *Commit `json:"commit"`
+}
+
+type Tree struct {
+	Hash    string      `json:"hash"` // 列出的提交
+	Path    string      `json:"path"`
+	Entries []TreeEntry `json:"entries"`
+}
+
+var ErrNotDir = errors.New("not a directory")
+
+// Tree lists the directory p, the root if empty, at the commit hash, HEAD if
+// empty. Directories come first, each entry has the last commit that
+// changed it.
+func (r *GitRepo) Tree(hash, p string) (*Tree, error) {
+	repo := r.repo()
+	if repo == nil {
+		return nil, errors.New("repository is not opened")
+	}
+	h := plumbing.NewHash(hash)
+	if hash == "" {
+		h = r.headHash()
+		if h.IsZero() {
+			return &Tree{Path: p, Entries: []TreeEntry{}}, nil
+		}
+	} else if !plumbing.IsHash(hash) {
+		return nil, fmt.Errorf("invalid hash: %s", hash)
+	}
+	commit, err := repo.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+	tree, err := subtree(commit, p)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return nil, fmt.Errorf("%s: %w", p, ErrNotDir)
+	}
+
+	res := &Tree{Hash: commit.Hash.String(), Path: p, Entries: make([]TreeEntry, len(tree.Entries))}
+	for i, e := range tree.Entries {
+		te := TreeEntry{Name: e.Name, Path: path.Join(p, e.Name), Mode: fmt.Sprintf("%06o", uint32(e.Mode))}
+		switch e.Mode {
+		case filemode.Dir:
+			te.Type = "dir"
+		case filemode.Symlink:
+			te.Type = "symlink"
+		case filemode.Submodule:
+			te.Type = "submodule"
+		default:
+			te.Type = "file"
+		}
+		if e.Mode.IsFile() {
+			te.Size, err = repo.Storer.EncodedObjectSize(e.Hash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res.Entries[i] = te
+	}
+	err = lastCommits(commit, p, tree, res.Entries)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res.Entries, func(i, j int) bool {
+		a, b := res.Entries[i], res.Entries[j]
+		if (a.Type == "dir") != (b.Type == "dir") {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+	return res, nil
+}
+
+// subtree returns the tree at p in commit, nil if p is not a directory and
+// object.ErrDirectoryNotFound if it does not exist.
+func subtree(commit *object.Commit, p string) (*object.Tree, error) {
+	tree, err := commit.Tree()
+	if err != nil || p == "" {
+		return tree, err
+	}
+	e, err := tree.FindEntry(p)
+	if err == object.ErrEntryNotFound {
+		return nil, object.ErrDirectoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Mode != filemode.Dir {
+		return nil, nil
+	}
+	return tree.Tree(p)
+}
+
+// lastCommits walks the first parents of commit and sets the commit of each
+// entry to the last one that changed it.
+func lastCommits(commit *object.Commit, p string, tree *object.Tree, entries []TreeEntry) error {
+	pending := make(map[string]plumbing.Hash, len(tree.Entries))
+	index := make(map[string]int, len(tree.Entries))
+	for i, e := range tree.Entries {
+		pending[e.Name] = e.Hash
+		index[e.Name] = i
+	}
+	c := commit
+	for n := 0; len(pending) > 0 && n < maxTreeWalk; n++ {
+		var parentTree *object.Tree
+		var parent *object.Commit
+		if c.NumParents() > 0 {
+			var err error
+			parent, err = c.Parent(0)
+			if err != nil {
+				return err
+			}
+			parentTree, err = subtree(parent, p)
+			if err != nil && err != object.ErrDirectoryNotFound {
+				return err
+			}
+		}
+		// 目录未变化时跳过
+		if parentTree == nil || parentTree.Hash != tree.Hash {
+			for name, h := range pending {
+				if parentTree != nil {
+					if e, err := parentTree.FindEntry(name); err == nil && e.Hash == h {
+						continue
+					}
+				}
+				entries[index[name]].Commit = toCommit(c)
+				delete(pending, name)
+			}
+		}
+		if parent == nil {
+			break
+		}
+		c = parent
+		if parentTree != nil {
+			tree = parentTree
+		}
+	}
+	return nil
+}
+
+func toCommit(c *object.Commit) *Commit {
+	return &Commit{
+		Hash:    c.Hash.String(),
+		Message: c.Message,
+		Author:  c.Author.Name,
+		Date:    c.Author.When.Format(time.DateTime),
+		Email:   c.Author.Email,
+	}
+}
@@ -0,0 +1,65 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charghet/go-sync/internal/config"
+)
+
+func TestTree(t *testing.T) {
+	r := newTestRepo(t, config.BackendGoGit, map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "c"})
+	c1 := head(t, r)
+	writeFile(t, filepath.Join(r.RepoConfig.Path, "dir", "b.txt"), "b2")
+	r.Commit("change b")
+	c2 := head(t, r)
+	writeFile(t, filepath.Join(r.RepoConfig.Path, "run.sh"), "#!/bin/sh\n")
+	os.Chmod(filepath.Join(r.RepoConfig.Path, "run.sh"), 0755)
+	r.Commit("add run.sh")
+	c3 := head(t, r)
+
+	tree, err := r.Tree("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Hash != c3 {
+		t.Errorf("Hash = %s, want HEAD", tree.Hash)
+	}
+	want := []struct {
+		name, typ, mode string
+		size            int64
+		commit          string
+	}{
+		{"dir", "dir", "040000", 0, c2},
+		{"a.txt", "file", "100644", 1, c1},
+		{"run.sh", "file", "100755", 10, c3},
+	}
+	if len(tree.Entries) != len(want) {
+		t.Fatalf("Entries = %+v", tree.Entries)
+	}
+	for i, w := range want {
+		e := tree.Entries[i]
+		if e.Name != w.name || e.Type != w.typ || e.Mode != w.mode || e.Size != w.size || e.Commit == nil || e.Commit.Hash != w.commit {
+			t.Errorf("Entries[%d] = %+v %+v, want %+v", i, e, e.Commit, w)
+		}
+	}
+
+	tree, err = r.Tree(c1, "/dir/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Path != "dir" || len(tree.Entries) != 2 || tree.Entries[0].Path != "dir/sub" || tree.Entries[1].Path != "dir/b.txt" || tree.Entries[1].Commit.Hash != c1 {
+		t.Errorf("Tree(c1, dir) = %+v", tree)
+	}
+
+	_, err = r.Tree("", "a.txt")
+	if !errors.Is(err, ErrNotDir) {
+		t.Errorf("Tree of a file: %v", err)
+	}
+	_, err = r.Tree("", "missing")
+	if err == nil {
+		t.Error("Tree of a missing path: expected an error")
+	}
+}
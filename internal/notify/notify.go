@@ -3,6 +3,7 @@ package notify
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/charghet/go-sync/pkg/logger"
@@ -13,6 +14,8 @@ type Notify struct {
 	watcher *fsnotify.Watcher
 	Events  chan fsnotify.Event
 	Errors  chan error
+	done    chan struct{}
+	once    sync.Once
 }
 
 func NewNotify() (*Notify, error) {
@@ -21,10 +24,16 @@ func NewNotify() (*Notify, error) {
 		logger.Fatal("Failed to create fsnotify watcher:", err)
 		return nil, err
 	}
-	return &Notify{watcher: watcher}, nil
+	return &Notify{watcher: watcher, done: make(chan struct{})}, nil
 }
 
+// Add watches p, and every directory below it. Events have absolute names,
+// also when p is relative.
 func (n *Notify) Add(p string) error {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
 	info, err := os.Stat(p)
 	if err != nil {
 		logger.Warn("Failed to stat path:", p, "Error:", err)
@@ -46,11 +55,17 @@ func (n *Notify) Add(p string) error {
 		logger.Info("Added watcher for file:", p)
 	}
 
-	n.Events = make(chan fsnotify.Event, 10)
-	n.Errors = make(chan error, 10)
+	events := make(chan fsnotify.Event, 10)
+	errs := make(chan error, 10)
+	n.Events = events
+	n.Errors = errs
 	go func() {
+		defer close(events)
+		defer close(errs)
 		for {
 			select {
+			case <-n.done:
+				return
 			case event, ok := <-n.watcher.Events:
 				if !ok {
 					return
@@ -75,12 +90,20 @@ func (n *Notify) Add(p string) error {
 						logger.Info("Added recursive watch for created directory:", event.Name)
 					}
 				}
-				n.Events <- event
+				select {
+				case events <- event:
+				case <-n.done:
+					return
+				}
 			case err, ok := <-n.watcher.Errors:
 				if !ok {
 					return
 				}
-				n.Errors <- err
+				select {
+				case errs <- err:
+				case <-n.done:
+					return
+				}
 			}
 		}
 	}()
@@ -89,6 +112,9 @@ func (n *Notify) Add(p string) error {
 }
 
 func (n *Notify) Close() error {
+	n.once.Do(func() {
+		close(n.done)
+	})
 	if n.watcher != nil {
 		err := n.watcher.Close()
 		if err != nil {
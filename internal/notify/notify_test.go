@@ -2,7 +2,9 @@ package notify
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestAdd(t *testing.T) {
@@ -40,3 +42,27 @@ func TestAdd(t *testing.T) {
 	}()
 	<-make(chan struct{})
 }
+
+func TestAddRelative(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.Mkdir("repo", 0755)
+	n, err := NewNotify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	err = n.Add("repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join("repo", "a.txt"), []byte("a"), 0644)
+	select {
+	case event := <-n.Events:
+		if want := filepath.Join(dir, "repo", "a.txt"); event.Name != want {
+			t.Errorf("event.Name = %s, want %s", event.Name, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
@@ -0,0 +1,46 @@
+package run
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/internal/git"
+	"github.com/charghet/go-sync/pkg/logger"
+)
+
+type OnceResult struct {
+	Name     string  `json:"name"`
+	Path     string  `json:"path"`
+	Ok       bool    `json:"ok"`
+	Head     string  `json:"head"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration"` // 秒
+}
+
+// Once opens every repository with Open(true), i.e. pull, commit and push,
+// without watching for changes. Failed repositories do not stop the others.
+func (r *Runner) Once() []OnceResult {
+	repos := config.GetConfig().Repos
+	res := make([]OnceResult, len(repos))
+	workers := make([]*worker, len(repos))
+	for i, repoConfig := range repos {
+		start := time.Now()
+		repo := git.NewGitRepo(repoConfig)
+		workers[i] = &worker{repo: repo}
+		res[i] = OnceResult{Name: repoConfig.Name, Path: repoConfig.Path}
+		err := repo.Open(true)
+		if err != nil {
+			logger.Danger(fmt.Sprintf("[%v]", repoConfig.Name), "Sync failed:", err)
+			res[i].Error = err.Error()
+		} else {
+			res[i].Ok = true
+			res[i].Head = repo.Status().Head
+		}
+		res[i].Duration = time.Since(start).Seconds()
+	}
+	r.mu.Lock()
+	r.workers = workers
+	r.mu.Unlock()
+	return res
+}
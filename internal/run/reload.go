@@ -0,0 +1,156 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/charghet/go-sync/internal/config"
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Reload reads the config file again and applies it: new repositories are
+// started, removed ones are stopped after committing pending changes, and
+// debounce, ignore and pull are updated in place. An invalid config is
+// rejected and nothing changes. It returns the changed settings that need a
+// restart.
+func (r *Runner) Reload() ([]string, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	restart, err := config.Reload()
+	if err != nil {
+		var verr config.ValidationError
+		if errors.As(err, &verr) {
+			for _, p := range verr {
+				logger.Danger("[config]", p.String())
+			}
+		}
+		logger.Danger("[config]", "Reload rejected, keeping the running config:", err)
+		return nil, err
+	}
+	for _, s := range restart {
+		logger.Warn("[config]", s, "changed, restart go-sync to apply it.")
+	}
+	if r.ctx != nil {
+		r.apply(config.GetConfig().Repos)
+	}
+	logger.Info("[config]", "Config reloaded.")
+	return restart, nil
+}
+
+func (r *Runner) apply(repos []config.RepoConfig) {
+	r.mu.RLock()
+	old := slices.Clone(r.workers)
+	r.mu.RUnlock()
+
+	byId := make(map[string]*worker, len(old))
+	for _, w := range old {
+		byId[w.repo.RepoConfig.Id] = w
+	}
+	workers := make([]*worker, len(repos))
+	kept := map[*worker]bool{}
+	for i, rc := range repos {
+		// 打开失败的仓库没有 watcher，重新加载时重试
+		if w, ok := byId[rc.Id]; ok && w.cancel != nil && sameRepo(w.repo.RepoConfig, rc) {
+			workers[i] = w
+			kept[w] = true
+		}
+	}
+
+	r.mu.Lock()
+	for i, w := range workers {
+		if w != nil {
+			r.update(w, repos[i])
+		}
+	}
+	r.mu.Unlock()
+
+	for _, w := range old {
+		if kept[w] {
+			continue
+		}
+		logger.Info(fmt.Sprintf("[%v]", w.repo.RepoConfig.Name), "Stopping repository.")
+		w.stop()
+	}
+	for i, rc := range repos {
+		if workers[i] == nil {
+			logger.Info(fmt.Sprintf("[%v]", rc.Name), "Starting repository.")
+			workers[i] = r.start(rc)
+		}
+	}
+
+	r.mu.Lock()
+	r.workers = workers
+	r.mu.Unlock()
+}
+
+// update changes the settings that apply without reopening the repository,
+// r.mu must be held.
+func (r *Runner) update(w *worker, rc config.RepoConfig) {
+	c := &w.repo.RepoConfig
+	if *c.Debounce != *rc.Debounce || *c.Ignore != *rc.Ignore || *c.Pull != *rc.Pull {
+		logger.Info(fmt.Sprintf("[%v]", rc.Name), "Updated settings, debounce:", *rc.Debounce, "ignore:", *rc.Ignore, "pull:", *rc.Pull)
+	}
+	c.Debounce = rc.Debounce
+	c.Ignore = rc.Ignore
+	c.Pull = rc.Pull
+}
+
+// sameRepo reports whether a and b only differ in the settings update can
+// change.
+func sameRepo(a, b config.RepoConfig) bool {
+	a.Debounce, a.Ignore, a.Pull = nil, nil, nil
+	b.Debounce, b.Ignore, b.Pull = nil, nil, nil
+	return a == b
+}
+
+// WatchConfig reloads the config when the config file changes.
+func (r *Runner) WatchConfig(ctx context.Context) {
+	p, err := filepath.Abs(config.Path())
+	if err != nil {
+		logger.Warn("[config]", "Failed to watch config file:", err)
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("[config]", "Failed to watch config file:", err)
+		return
+	}
+	// 编辑器保存时常常替换文件，所以监听所在目录
+	err = watcher.Add(filepath.Dir(p))
+	if err != nil {
+		watcher.Close()
+		logger.Warn("[config]", "Failed to watch config file:", err)
+		return
+	}
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Name != p || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				timer.Reset(500 * time.Millisecond)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("[config]", "Watch error:", err)
+			case <-timer.C:
+				r.Reload()
+			}
+		}
+	}()
+}
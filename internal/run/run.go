@@ -1,8 +1,9 @@
 package run
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/charghet/go-sync/internal/config"
@@ -12,94 +13,257 @@ import (
 )
 
 type Runner struct {
-	Repos        []*git.GitRepo
-	ignoreTimers []*time.Timer
+	mu       sync.RWMutex
+	workers  []*worker // 与配置中的仓库顺序一致
+	ctx      context.Context
+	wg       sync.WaitGroup
+	reloadMu sync.Mutex
+}
+
+// worker watches a single repository.
+type worker struct {
+	repo        *git.GitRepo
+	ignoreTimer *time.Timer
+	cancel      context.CancelFunc
+	done        chan struct{}
 }
 
 var runner *Runner
 
 func GetRunner() *Runner {
 	if runner == nil {
-		runner = &Runner{
-			Repos:        make([]*git.GitRepo, len(config.GetConfig().Repos)),
-			ignoreTimers: make([]*time.Timer, len(config.GetConfig().Repos)),
-		}
+		runner = &Runner{}
 	}
 	return runner
 }
 
-func (r *Runner) Run() {
+// Repo returns the repository with id, or nil.
+func (r *Runner) Repo(id string) *git.GitRepo {
+	w := r.worker(id)
+	if w == nil {
+		return nil
+	}
+	return w.repo
+}
+
+// RepoAt returns the repository at the 1-based position in the config, or
+// nil. Positions change when the config is edited, use Repo instead.
+func (r *Runner) RepoAt(i int) *git.GitRepo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i <= 0 || i > len(r.workers) {
+		return nil
+	}
+	return r.workers[i-1].repo
+}
+
+func (r *Runner) worker(id string) *worker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, w := range r.workers {
+		if w.repo.RepoConfig.Id == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// Repos returns every repository in config order.
+func (r *Runner) Repos() []*git.GitRepo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*git.GitRepo, len(r.workers))
+	for i, w := range r.workers {
+		res[i] = w.repo
+	}
+	return res
+}
+
+// Run starts watching every repository. When ctx is cancelled the watchers
+// are closed and pending changes are committed and pushed, use Wait to wait
+// for that to finish. Without repositories it watches nothing until Reload
+// adds some.
+func (r *Runner) Run(ctx context.Context) {
 	logger.SetLogFile("run.log")
 	logger.Info("Starting go-sync...")
 
 	repos := config.GetConfig().Repos
 	if len(repos) == 0 {
-		logger.Warn("No repositories configured, exiting.")
-		os.Exit(0)
+		logger.Warn("No repositories configured, add one in the web ui or run `go-sync init`.")
 	}
+	r.ctx = ctx
+	workers := make([]*worker, len(repos))
 	for i, repoConfig := range repos {
-		repo := git.NewGitRepo(repoConfig)
-		r.Repos[i] = repo
-		err := repo.Open(*repoConfig.Pull)
-		if err != nil {
-			continue
-		}
+		workers[i] = r.start(repoConfig)
+	}
+	r.mu.Lock()
+	r.workers = workers
+	r.mu.Unlock()
+}
 
-		n, err := notify.NewNotify()
-		if err != nil {
-			continue
-		}
+// start opens the repository and watches it until the context of Run or its
+// own cancel func is done. A repository that fails to open is kept without
+// a watcher, so it still shows up in the web ui.
+func (r *Runner) start(repoConfig config.RepoConfig) *worker {
+	repo := git.NewGitRepo(repoConfig)
+	w := &worker{repo: repo, done: make(chan struct{})}
+	err := repo.Open(*repoConfig.Pull)
+	if err != nil {
+		close(w.done)
+		return w
+	}
 
-		err = n.Add(repoConfig.Path)
-		if err != nil {
-			continue
-		}
+	n, err := notify.NewNotify()
+	if err != nil {
+		close(w.done)
+		return w
+	}
 
-		r.ignoreTimers[i] = time.NewTimer(100 * time.Millisecond)
-		go func() {
-			timer := time.NewTimer(50 * time.Millisecond)
-			defer timer.Stop()
-			<-timer.C
-			ignoreTimer := r.ignoreTimers[i]
-			for {
+	err = n.Add(repoConfig.Path)
+	if err != nil {
+		n.Close()
+		close(w.done)
+		return w
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	w.cancel = cancel
+	w.ignoreTimer = time.NewTimer(100 * time.Millisecond)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(w.done)
+		defer n.Close()
+		timer := time.NewTimer(50 * time.Millisecond)
+		defer timer.Stop()
+		<-timer.C
+		reconcile := time.NewTicker(reconcileInterval)
+		defer reconcile.Stop()
+		ignoreTimer := w.ignoreTimer
+		pending := false
+		// 收到事件的路径，full 为 true 时暂存整个工作区
+		// 启动后第一次提交使用全量，包含未运行期间的修改
+		changed := make(map[string]struct{})
+		full := true
+		for {
+			select {
+			case <-ctx.Done():
+				if pending {
+					logger.Info(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Shutting down, committing pending changes.")
+					commitAndPush(repo, "auto commit on shutdown in "+time.Now().Format("2006-01-02 15:04:05"), changed, full)
+				}
+				return
+			case event, ok := <-n.Events:
+				if !ok {
+					return
+				}
+
+				pending = true
+				if len(changed) < maxChangedPaths {
+					changed[event.Name] = struct{}{}
+				} else {
+					full = true
+				}
+				timer.Stop()
+				r.mu.RLock()
+				debounce := time.Duration(*repo.RepoConfig.Debounce) * time.Second
+				r.mu.RUnlock()
+				timer.Reset(debounce)
+				logger.Info(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Received event:", event, "for path:", event.Name)
+			case <-timer.C:
 				select {
-				case event, ok := <-n.Events:
-					if !ok {
-						return
-					}
-
-					timer.Stop()
-					timer.Reset(time.Duration(*repo.RepoConfig.Debounce) * time.Second)
-					logger.Info(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Received event:", event, "for path:", event.Name)
-				case <-timer.C:
-					select {
-					case <-ignoreTimer.C:
-						logger.Info(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Timer expired, committing changes.")
-						c, err := repo.Commit("auto commit in " + time.Now().Format("2006-01-02 15:04:05"))
-						if err != nil {
-							logger.Warn(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Failed to commit changes:", err)
-						}
-						if c {
-							repo.Push()
-						}
-						ignoreTimer.Reset(100 * time.Millisecond)
-					default:
-						logger.Debug(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "ignoreTimer not stop, skip..")
-					}
-
-				case err, ok := <-n.Errors:
-					if !ok {
-						return
-					}
-					logger.Danger(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Error:", err)
+				case <-ignoreTimer.C:
+					logger.Info(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Timer expired, committing changes.")
+					commitAndPush(repo, "auto commit in "+time.Now().Format("2006-01-02 15:04:05"), changed, full)
+					pending = false
+					changed = make(map[string]struct{})
+					full = false
+					ignoreTimer.Reset(100 * time.Millisecond)
+				default:
+					logger.Debug(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "ignoreTimer not stop, skip..")
 				}
+			case <-reconcile.C:
+				// 定期暂存整个工作区，补上遗漏的事件
+				full = true
+				if !pending {
+					pending = true
+					timer.Reset(0)
+				}
+			case err, ok := <-n.Errors:
+				if !ok {
+					return
+				}
+				// 事件可能已丢失，例如队列溢出
+				full = true
+				logger.Danger(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Error:", err)
 			}
-		}()
+		}
+	}()
+	return w
+}
+
+// stop closes the watcher, pending changes are committed and pushed first.
+func (w *worker) stop() {
+	if w.cancel != nil {
+		w.cancel()
 	}
+	<-w.done
 }
 
-func (r *Runner) Ignore(id int) {
-	i := id - 1
-	r.ignoreTimers[i].Stop()
-	r.ignoreTimers[i].Reset(time.Duration(*config.GetConfig().Repos[i].Ignore) * time.Second)
+const (
+	// maxChangedPaths 超过后改为暂存整个工作区
+	maxChangedPaths = 1000
+	// reconcileInterval 全量暂存的间隔
+	reconcileInterval = 30 * time.Minute
+)
+
+// commitAndPush stages the changed paths, or the whole worktree if full is
+// set, then commits and pushes.
+func commitAndPush(repo *git.GitRepo, message string, changed map[string]struct{}, full bool) {
+	var c bool
+	var err error
+	if full {
+		c, err = repo.Commit(message)
+	} else {
+		paths := make([]string, 0, len(changed))
+		for p := range changed {
+			paths = append(paths, p)
+		}
+		c, err = repo.CommitPaths(message, paths)
+	}
+	if err != nil {
+		logger.Warn(fmt.Sprintf("[%v]", repo.RepoConfig.Name), "Failed to commit changes:", err)
+	}
+	if c {
+		repo.Push()
+	}
+}
+
+// Wait waits for the watchers to flush after the context given to Run is
+// cancelled. It returns false if they did not finish within timeout.
+func (r *Runner) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Ignore stops committing changes of the repository with id for a while,
+// e.g. after files were restored.
+func (r *Runner) Ignore(id string) {
+	w := r.worker(id)
+	if w == nil || w.ignoreTimer == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	w.ignoreTimer.Stop()
+	w.ignoreTimer.Reset(time.Duration(*w.repo.RepoConfig.Ignore) * time.Second)
 }
@@ -1,17 +1,144 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/charghet/go-sync/internal/config"
 	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/charghet/go-sync/pkg/util"
+	"github.com/charghet/go-sync/pkg/web"
 )
 
-func StartUp(dist EmbedFS) {
-	r := SetupRoute(dist)
+// StartUp serves the web ui until ctx is cancelled, then shuts the server
+// down gracefully within timeout.
+func StartUp(ctx context.Context, dist EmbedFS, timeout time.Duration) {
 	con := config.GetConfig()
-	err := r.Run(fmt.Sprintf("%s:%d", con.Server.Host, con.Server.Port))
+	err := web.Tokens.Load(con.Server.TokenStore)
 	if err != nil {
+		logger.Fatal("Failed to load api tokens:", con.Server.TokenStore, "Error:", err)
+	}
+	r := SetupRoute(dist, con.Server.BasePath)
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", con.Server.Host, con.Server.Port),
+		Handler: r,
+	}
+	l, err := listen(con.Server)
+	if err != nil {
+		logger.Fatal("Failed to listen:", err)
+	}
+	servers := []*http.Server{srv}
+
+	errs := make(chan error, 1)
+	if !con.Server.Tls.Enable {
+		logger.Info("Listening and serving HTTP on", l.Addr(), con.Server.BasePath)
+		go func() {
+			errs <- srv.Serve(l)
+		}()
+	} else {
+		srv.TLSConfig, err = tlsConfig(con.Server)
+		if err != nil {
+			logger.Fatal("Failed to load certificate:", err)
+		}
+		web.SecureCookie = true
+		if con.Server.Tls.RedirectPort != 0 {
+			servers = append(servers, redirectHttps(con.Server))
+		}
+		logger.Info("Listening and serving HTTPS on", l.Addr(), con.Server.BasePath)
+		go func() {
+			errs <- srv.ServeTLS(l, "", "")
+		}()
+	}
+
+	select {
+	case err = <-errs:
 		logger.Fatal(err)
+	case <-ctx.Done():
+	}
+	logger.Info("Shutting down web server...")
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, s := range servers {
+		err = s.Shutdown(sctx)
+		if err != nil {
+			logger.Warn("Failed to shut down web server:", err)
+		}
+	}
+}
+
+func listen(con config.ServerConfig) (net.Listener, error) {
+	if con.Socket == "" {
+		return net.Listen("tcp", fmt.Sprintf("%s:%d", con.Host, con.Port))
+	}
+	mode, err := strconv.ParseUint(con.SocketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket_mode %q: %v", con.SocketMode, err)
 	}
+	// 删除上次运行残留的 socket 文件
+	if info, err := os.Lstat(con.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(con.Socket)
+	}
+	l, err := net.Listen("unix", con.Socket)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(con.Socket, os.FileMode(mode))
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func tlsConfig(con config.ServerConfig) (*tls.Config, error) {
+	c := con.Tls
+	_, certErr := os.Stat(c.Cert)
+	_, keyErr := os.Stat(c.Key)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) && c.SelfSigned {
+		logger.Info("Generating self-signed certificate:", c.Cert)
+		hosts := []string{con.Host, "localhost", "127.0.0.1"}
+		if name, err := os.Hostname(); err == nil {
+			hosts = append(hosts, name)
+		}
+		err := util.GenerateSelfSigned(c.Cert, c.Key, hosts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	loader, err := util.NewCertLoader(c.Cert, c.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: loader.GetCertificate,
+	}, nil
+}
+
+func redirectHttps(con config.ServerConfig) *http.Server {
+	addr := fmt.Sprintf("%s:%d", con.Host, con.Tls.RedirectPort)
+	logger.Info("Redirecting HTTP on", addr, "to HTTPS")
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if con.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(con.Port))
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+	})}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logger.Danger("Failed to start https redirect:", err)
+		}
+	}()
+	return srv
 }
@@ -1,9 +1,20 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/charghet/go-sync/internal/config"
 	"github.com/charghet/go-sync/internal/git"
 	"github.com/charghet/go-sync/internal/run"
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/charghet/go-sync/pkg/util"
 	"github.com/charghet/go-sync/pkg/web"
 	"github.com/gin-gonic/gin"
 )
@@ -21,11 +32,13 @@ type LoginReq struct {
 	Password string `json:"password"`
 }
 
-var conf = config.GetConfig()
-
 func (c *MainController) Login(ctx *gin.Context) {
 	var req LoginReq
 	c.BindJSON(ctx, &req)
+	conf := config.GetConfig()
+	if conf.Auth.Proxy.Enable && conf.Auth.Proxy.DisableLogin {
+		panic(web.ServiceErr{Code: 403, Msg: "password login is disabled"})
+	}
 	if conf.User.Username == req.Username && conf.User.Password == req.Password {
 		token := c.SetLogin(ctx, req.Username)
 		c.ResponseOkJson(ctx, token)
@@ -34,38 +47,322 @@ func (c *MainController) Login(ctx *gin.Context) {
 	panic(web.ServiceErr{Code: 400, Msg: "username or password is incorrect"})
 }
 
+func (c *MainController) Logout(ctx *gin.Context) {
+	c.SetLogout(ctx)
+	c.ResponseOkJson(ctx, "ok")
+}
+
+// UserStamp fingerprints the configured credentials, so changing the password
+// revokes every session issued before the change.
+func UserStamp(username string) string {
+	conf := config.GetConfig()
+	if username != conf.User.Username {
+		return ""
+	}
+	return util.Sha256Hex(conf.User.Username + ":" + conf.User.Password)
+}
+
+type SessionRes struct {
+	web.Session
+	Current bool `json:"current"`
+}
+
+func (c *MainController) Sessions(ctx *gin.Context) {
+	current := c.GetSession(ctx)
+	sessions := web.Sessions.List()
+	res := make([]SessionRes, len(sessions))
+	for i, s := range sessions {
+		res[i] = SessionRes{Session: s, Current: current != nil && current.Id == s.Id}
+	}
+	c.ResponseOkJson(ctx, res)
+}
+
+type SessionRevokeReq struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+}
+
+func (c *MainController) RevokeSession(ctx *gin.Context) {
+	var req SessionRevokeReq
+	c.BindJSON(ctx, &req)
+	n := 0
+	if req.Id != "" {
+		if web.Sessions.Revoke(req.Id) {
+			n = 1
+		}
+	} else if req.Username != "" {
+		n = web.Sessions.RevokeUser(req.Username)
+	} else {
+		panic(web.ServiceErr{Code: 300, Msg: "id or username is required"})
+	}
+	c.ResponseOkJson(ctx, n)
+}
+
+func (c *MainController) Tokens(ctx *gin.Context) {
+	c.ResponseOkJson(ctx, web.Tokens.List())
+}
+
+type CreateTokenReq struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Expires int      `json:"expires"` // 有效天数 0为永久
+}
+
+type CreateTokenRes struct {
+	Info  web.Token `json:"info"`
+	Token string    `json:"token"` // 仅在创建时返回一次
+}
+
+func (c *MainController) CreateToken(ctx *gin.Context) {
+	var req CreateTokenReq
+	c.BindJSON(ctx, &req)
+	if req.Name == "" {
+		panic(web.ServiceErr{Code: 300, Msg: "name is required"})
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{web.ScopeRead}
+	}
+	if req.Expires < 0 {
+		panic(web.ServiceErr{Code: 300, Msg: "expires can not be negative"})
+	}
+	value, token, err := web.Tokens.Create(req.Name, req.Scopes, time.Duration(req.Expires)*24*time.Hour)
+	web.CheckServiceErr(err, "")
+	c.ResponseOkJson(ctx, CreateTokenRes{Info: token, Token: value})
+}
+
+type TokenRevokeReq struct {
+	Id string `json:"id"`
+}
+
+func (c *MainController) RevokeToken(ctx *gin.Context) {
+	var req TokenRevokeReq
+	c.BindJSON(ctx, &req)
+	ok, err := web.Tokens.Revoke(req.Id)
+	web.CheckInnerErr(err, "can not save tokens")
+	if !ok {
+		panic(web.ServiceErr{Code: 300, Msg: "token not found"})
+	}
+	c.ResponseOkJson(ctx, "ok")
+}
+
+type ConfigRes struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+func (c *MainController) Config(ctx *gin.Context) {
+	b, err := os.ReadFile(config.Path())
+	if err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+	c.ResponseOkJson(ctx, ConfigRes{Path: config.Path(), Content: string(b)})
+}
+
+type ConfigUpdateReq struct {
+	Content string `json:"content"`
+}
+
+type ConfigUpdateRes struct {
+	Restart []string `json:"restart"` // 需要重启才能生效的设置
+}
+
+func (c *MainController) UpdateConfig(ctx *gin.Context) {
+	var req ConfigUpdateReq
+	c.BindJSON(ctx, &req)
+	configEdit.Lock()
+	defer configEdit.Unlock()
+	c.saveConfig(ctx, []byte(req.Content))
+}
+
+// configEdit serializes changes to the config file.
+var configEdit sync.Mutex
+
+// saveConfig writes the config file and applies it to the running repositories.
+func (c *MainController) saveConfig(ctx *gin.Context, b []byte) {
+	err := config.Update(b)
+	checkConfigErr(err)
+	restart, err := run.GetRunner().Reload()
+	web.CheckServiceErr(err, "")
+	c.ResponseOkJson(ctx, ConfigUpdateRes{Restart: restart})
+}
+
+// checkConfigErr lists the problems of an invalid config in data.
+func checkConfigErr(err error) {
+	var verr config.ValidationError
+	if errors.As(err, &verr) {
+		panic(web.ServiceErr{Code: 400, Msg: "invalid config", Data: verr})
+	}
+	if err != nil {
+		panic(web.ServiceErr{Code: 400, Msg: err.Error()})
+	}
+}
+
 type RepoIdReq struct {
-	Id int `json:"id"`
+	Id RepoRef `json:"id"`
+}
+
+// RepoRef is the id of a repository. The 1-based position in the config is
+// still accepted as a number but deprecated, it changes when repositories
+// are added, removed or reordered.
+type RepoRef struct {
+	Id    string
+	Index int
+}
+
+func (r *RepoRef) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &r.Id)
+	}
+	return json.Unmarshal(b, &r.Index)
 }
 
 func (c *MainController) Repos(ctx *gin.Context) {
 	c.ResponseOkJson(ctx, config.RepoInfo())
 }
 
+type RepoReq struct {
+	Id       string `json:"id"` // 为空时使用 name
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Url      string `json:"url"`
+	Branch   string `json:"branch"`
+	Username string `json:"username"`
+	Password string `json:"password"` // 更新时为空表示不修改
+	Email    string `json:"email"`
+	Debounce *int   `json:"debounce"`
+	Ignore   *int   `json:"ignore"`
+	Pull     *bool  `json:"pull"`
+}
+
+func (r RepoReq) config() config.RepoConfig {
+	return config.RepoConfig{
+		Id:       r.Id,
+		Name:     r.Name,
+		Path:     r.Path,
+		Url:      r.Url,
+		Branch:   r.Branch,
+		Username: r.Username,
+		Password: r.Password,
+		Email:    r.Email,
+		Debounce: r.Debounce,
+		Ignore:   r.Ignore,
+		Pull:     r.Pull,
+	}
+}
+
+// CreateRepo clones or initialises the repository, then adds it to the
+// config file and starts watching it.
+func (c *MainController) CreateRepo(ctx *gin.Context) {
+	var req RepoReq
+	c.BindJSON(ctx, &req)
+	configEdit.Lock()
+	defer configEdit.Unlock()
+	b, con, err := config.AddRepo(req.config())
+	checkConfigErr(err)
+	rc := con.Repos[len(con.Repos)-1]
+	err = git.NewGitRepo(rc).Create(*rc.Pull)
+	web.CheckServiceErr(err, "")
+	c.saveConfig(ctx, b)
+}
+
+// RepoUpdateReq can not change the id of a repository.
+type RepoUpdateReq struct {
+	Id RepoRef `json:"id"`
+	RepoReq
+}
+
+func (c *MainController) UpdateRepo(ctx *gin.Context) {
+	var req RepoUpdateReq
+	c.BindJSON(ctx, &req)
+	configEdit.Lock()
+	defer configEdit.Unlock()
+	rc := req.config()
+	rc.Id = ""
+	b, _, err := config.SetRepo(repoIndex(req.Id), rc)
+	checkConfigErr(err)
+	c.saveConfig(ctx, b)
+}
+
+// DeleteRepo stops syncing the repository, its files are kept.
+func (c *MainController) DeleteRepo(ctx *gin.Context) {
+	var req RepoIdReq
+	c.BindJSON(ctx, &req)
+	configEdit.Lock()
+	defer configEdit.Unlock()
+	b, _, err := config.RemoveRepo(repoIndex(req.Id))
+	checkConfigErr(err)
+	c.saveConfig(ctx, b)
+}
+
 type CommitsReq struct {
 	RepoIdReq
 	Pager web.Pager `json:"pager"`
+	// 上一页返回的 next，设置后忽略 pager.index
+	Cursor string `json:"cursor"`
+	// 以下为筛选条件，时间为 2006-01-02 或 2006-01-02 15:04:05，只有日期时 to 包含当天
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Author  string `json:"author"`  // 名字或邮箱
+	Message string `json:"message"` // 提交信息包含的文字
+	Path    string `json:"path"`    // 修改的文件，如 *.md 或 docs/*
+}
+
+type CommitsRes struct {
+	Total int          `json:"total"` // 有筛选条件时为 -1
+	List  []git.Commit `json:"list"`
+	Next  string       `json:"next"` // 下一页的 cursor，最后一页为空
 }
 
 func (c *MainController) Commits(ctx *gin.Context) {
 	var req CommitsReq
 	c.BindJSON(ctx, &req)
 	r := getRepo(req.Id)
-	commits, total, err := r.GetCommit(req.Pager.Index, req.Pager.Size)
-	web.CheckInnerErr(err, "can not get commits")
-	c.ResponseOkJson(ctx, struct {
-		Total int          `json:"total"`
-		List  []git.Commit `json:"list"`
-	}{
-		Total: total,
-		List:  commits,
-	})
+	q := git.CommitQuery{
+		Since:   parseDate("from", req.From, false),
+		Until:   parseDate("to", req.To, true),
+		Author:  req.Author,
+		Message: req.Message,
+		Path:    req.Path,
+	}
+	skip := 0
+	if req.Cursor == "" && req.Pager.Index > 1 {
+		skip = (req.Pager.Index - 1) * req.Pager.Size
+	}
+	commits, next, err := r.Commits(q, req.Cursor, skip, req.Pager.Size)
+	web.CheckServiceErr(err, "")
+	// 筛选后的数量需要遍历整个历史，不计算
+	total := -1
+	if q.IsZero() {
+		total, err = r.Total()
+		web.CheckInnerErr(err, "can not count commits")
+	}
+	c.ResponseOkJson(ctx, CommitsRes{Total: total, List: commits, Next: next})
+}
+
+// parseDate parses a date of the commit filter in local time, a date
+// without time at the end of the day if end is set.
+func parseDate(name, s string, end bool) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.ParseInLocation(time.DateTime, s, time.Local); err == nil {
+		return t
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		panic(web.ServiceErr{Code: 300, Msg: name + " must be like 2006-01-02 or 2006-01-02 15:04:05"})
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t
 }
 
 type RevertReq struct {
 	RepoIdReq
 	Hash string   `json:"hash"`
 	File []string `json:"file"`
+	git.RestoreOptions
 }
 
 func (c *MainController) Revert(ctx *gin.Context) {
@@ -75,9 +372,81 @@ func (c *MainController) Revert(ctx *gin.Context) {
 	if len(req.File) == 0 {
 		req.File = []string{"."}
 	}
-	err := r.RevertFile(req.Hash, req.File)
+	checkRestore(ctx, req.RestoreOptions)
+	res, err := r.RevertFile(req.Hash, req.File, req.RestoreOptions)
+	web.CheckServiceErr(err, "")
+	restored(r, req.RestoreOptions)
+	// 每个文件的结果，失败的带有 error
+	c.ResponseOkJson(ctx, res)
+}
+
+// checkRestore requires the admin scope for a target directory, which can be
+// anywhere on the server.
+func checkRestore(ctx *gin.Context, opts git.RestoreOptions) {
+	if opts.Dir != "" && !ctx.MustGet(web.AuthKey).(*web.Auth).Can(web.ScopeAdmin) {
+		panic(web.ServiceErr{Code: 403, Msg: "permission denied, admin scope required for dir"})
+	}
+}
+
+// restored holds back the commit of files restored over the worktree, copies
+// are excluded or meant to be committed.
+func restored(r *git.GitRepo, opts git.RestoreOptions) {
+	if opts.IsZero() {
+		run.GetRunner().Ignore(r.RepoConfig.Id)
+	}
+}
+
+type DeletedReq struct {
+	RepoIdReq
+	From string `json:"from"` // 删除时间范围，格式同 CommitsReq
+	To   string `json:"to"`
+}
+
+func (c *MainController) Deleted(ctx *gin.Context) {
+	var req DeletedReq
+	c.BindJSON(ctx, &req)
+	r := getRepo(req.Id)
+	list, err := r.Deleted(parseDate("from", req.From, false), parseDate("to", req.To, true))
 	web.CheckServiceErr(err, "")
-	run.GetRunner().Ignore(req.Id)
+	c.ResponseOkJson(ctx, list)
+}
+
+type RestoreDeletedReq struct {
+	RepoIdReq
+	Path []string `json:"path"`
+	git.RestoreOptions
+}
+
+func (c *MainController) RestoreDeleted(ctx *gin.Context) {
+	var req RestoreDeletedReq
+	c.BindJSON(ctx, &req)
+	r := getRepo(req.Id)
+	if len(req.Path) == 0 {
+		panic(web.ServiceErr{Code: 300, Msg: "path is required"})
+	}
+	checkRestore(ctx, req.RestoreOptions)
+	res, err := r.RestoreDeleted(req.Path, req.RestoreOptions)
+	web.CheckServiceErr(err, "")
+	restored(r, req.RestoreOptions)
+	c.ResponseOkJson(ctx, res)
+}
+
+func (c *MainController) Status(ctx *gin.Context) {
+	repos := run.GetRunner().Repos()
+	res := make([]git.Status, len(repos))
+	for i, r := range repos {
+		res[i] = r.Status()
+	}
+	c.ResponseOkJson(ctx, res)
+}
+
+func (c *MainController) Sync(ctx *gin.Context) {
+	var req RepoIdReq
+	c.BindJSON(ctx, &req)
+	r := getRepo(req.Id)
+	err := r.Sync("sync in " + time.Now().Format("2006-01-02 15:04:05"))
+	web.CheckServiceErr(err, "")
+	run.GetRunner().Ignore(r.RepoConfig.Id)
 	c.ResponseOkJson(ctx, "ok")
 }
 
@@ -95,9 +464,67 @@ func (c *MainController) Changes(ctx *gin.Context) {
 	c.ResponseOkJson(ctx, changes)
 }
 
-func getRepo(id int) *git.GitRepo {
-	if id <= 0 || id > len(run.GetRunner().Repos) {
+type TreeReq struct {
+	RepoIdReq
+	Hash string `json:"hash"` // 为空时为 HEAD
+	Path string `json:"path"` // 为空时为根目录
+}
+
+func (c *MainController) Tree(ctx *gin.Context) {
+	var req TreeReq
+	c.BindJSON(ctx, &req)
+	r := getRepo(req.Id)
+	tree, err := r.Tree(req.Hash, req.Path)
+	web.CheckServiceErr(err, "")
+	c.ResponseOkJson(ctx, tree)
+}
+
+// Archive streams a zip or tar.gz of a commit. It is a GET request so the
+// browser can download it directly, the query takes id, hash, format (zip
+// or tar.gz) and path, which may repeat.
+func (c *MainController) Archive(ctx *gin.Context) {
+	r := getRepo(RepoRef{Id: ctx.Query("id")})
+	format := ctx.DefaultQuery("format", git.FormatZip)
+	if format != git.FormatZip && format != git.FormatTarGz {
+		panic(web.ServiceErr{Code: 300, Msg: "format must be zip or tar.gz"})
+	}
+	a, err := r.Archive(ctx.Query("hash"), ctx.QueryArray("path"))
+	web.CheckServiceErr(err, "")
+
+	contentType := "application/zip"
+	if format == git.FormatTarGz {
+		contentType = "application/gzip"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name(format)}))
+	ctx.Status(http.StatusOK)
+	// 已经开始发送，出错时只能中断连接
+	err = a.Write(ctx.Writer, format)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("[%v]", r.RepoConfig.Name), "Failed to write archive:", err)
+		ctx.Abort()
+	}
+}
+
+func getRepo(ref RepoRef) *git.GitRepo {
+	var r *git.GitRepo
+	if ref.Id != "" {
+		r = run.GetRunner().Repo(ref.Id)
+	} else {
+		logger.Warn("numeric repository ids are deprecated, use the id from /api/repos")
+		r = run.GetRunner().RepoAt(ref.Index)
+	}
+	if r == nil {
+		panic(web.ServiceErr{Code: 300, Msg: "id not found"})
+	}
+	return r
+}
+
+// repoIndex returns the position of the repository in the config file.
+func repoIndex(ref RepoRef) int {
+	i := config.RepoIndex(getRepo(ref).RepoConfig.Id)
+	if i < 0 {
 		panic(web.ServiceErr{Code: 300, Msg: "id not found"})
 	}
-	return run.GetRunner().Repos[id-1]
+	return i
 }
@@ -1,11 +1,14 @@
 package web
 
 import (
+	"bytes"
 	"embed"
 	"io/fs"
 	"net/http"
+	"strings"
 	"sync"
 
+	"github.com/charghet/go-sync/internal/config"
 	"github.com/charghet/go-sync/internal/web/controller"
 	"github.com/charghet/go-sync/pkg/logger"
 	"github.com/charghet/go-sync/pkg/web"
@@ -19,33 +22,88 @@ type EmbedFS struct {
 	Prefix string
 }
 
-func SetupRoute(dist EmbedFS) (router *gin.Engine) {
+func SetupRoute(dist EmbedFS, base string) (router *gin.Engine) {
 	once.Do(func() {
 		router = gin.Default()
 		router.Use(web.ErrorHandler)
+		web.ApiPrefix = base + "/api"
+		setupProxyAuth(config.GetConfig().Auth.Proxy)
 		router.Use(web.CookieHandler)
-		RegisterWebRoutes(router, dist)
+		web.Sessions.Stamp = controller.UserStamp
+		RegisterWebRoutes(router, dist, base)
 	})
 	return router
 }
 
-func RegisterWebRoutes(router *gin.Engine, dist EmbedFS) {
-	prefix := "/api"
+func setupProxyAuth(con config.ProxyAuthConfig) {
+	if !con.Enable {
+		return
+	}
+	p, err := web.NewProxyAuth(con.Header, con.Trusted, con.Users, con.DefaultRole)
+	if err != nil {
+		logger.Fatal("Failed to setup proxy auth:", err)
+	}
+	web.Proxy = p
+	logger.Info("Proxy auth enabled, trusting header", con.Header, "from", con.Trusted)
+}
+
+func RegisterWebRoutes(router *gin.Engine, dist EmbedFS, base string) {
+	api := router.Group(base + "/api")
 	c := controller.NewMainController()
-	router.POST(prefix+"/login", c.Login)
-	router.POST(prefix+"/repos", c.Repos)
-	router.POST(prefix+"/commits", c.Commits)
-	router.POST(prefix+"/revert", c.Revert)
-	router.POST(prefix+"/changes", c.Changes)
+	read := web.Require(web.ScopeRead)
+	write := web.Require(web.ScopeWrite)
+	admin := web.Require(web.ScopeAdmin)
+	api.POST("/login", c.Login)
+	api.POST("/logout", c.Logout)
+	api.POST("/sessions", admin, c.Sessions)
+	api.POST("/sessions/revoke", admin, c.RevokeSession)
+	api.POST("/tokens", admin, c.Tokens)
+	api.POST("/tokens/create", admin, c.CreateToken)
+	api.POST("/tokens/revoke", admin, c.RevokeToken)
+	api.POST("/config", admin, c.Config)
+	api.POST("/config/update", admin, c.UpdateConfig)
+	api.POST("/repos", read, c.Repos)
+	api.POST("/repos/create", admin, c.CreateRepo)
+	api.POST("/repos/update", admin, c.UpdateRepo)
+	api.POST("/repos/delete", admin, c.DeleteRepo)
+	api.POST("/commits", read, c.Commits)
+	api.POST("/revert", write, c.Revert)
+	api.POST("/deleted", read, c.Deleted)
+	api.POST("/deleted/restore", write, c.RestoreDeleted)
+	api.POST("/changes", read, c.Changes)
+	api.POST("/tree", read, c.Tree)
+	api.GET("/archive", read, c.Archive)
+	api.POST("/status", read, c.Status)
+	api.POST("/sync", write, c.Sync)
 
 	sfs, err := fs.Sub(dist.FS, dist.Prefix)
 	if err != nil {
 		logger.Fatal("Failed to get static file:", err)
 	}
-	router.StaticFS("/", http.FS(sfs))
+	index, err := fs.ReadFile(sfs, "index.html")
+	if err == nil {
+		// 页面资源使用相对路径，通过 <base> 指向挂载路径
+		index = bytes.Replace(index, []byte("<head>"), []byte(`<head><base href="`+base+`/">`), 1)
+	}
+	files := http.StripPrefix(base, http.FileServer(http.FS(sfs)))
 	router.NoRoute(func(ctx *gin.Context) {
-		index, err := dist.FS.ReadFile(dist.Prefix + "/index.html")
-		if err != nil {
+		p := ctx.Request.URL.Path
+		if base != "" && p == base {
+			ctx.Redirect(http.StatusMovedPermanently, base+"/")
+			return
+		}
+		name, ok := strings.CutPrefix(p, base+"/")
+		if !ok || strings.HasPrefix(p, web.ApiPrefix+"/") {
+			ctx.String(404, "404 page not found")
+			return
+		}
+		if name != "" && name != "index.html" {
+			if info, err := fs.Stat(sfs, name); err == nil && !info.IsDir() {
+				files.ServeHTTP(ctx.Writer, ctx.Request)
+				return
+			}
+		}
+		if index == nil {
 			ctx.String(404, "index.html not found")
 			return
 		}
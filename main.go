@@ -2,8 +2,9 @@ package main
 
 import (
 	"embed"
+	"os"
 
-	"github.com/charghet/go-sync/internal/run"
+	"github.com/charghet/go-sync/internal/flag"
 	"github.com/charghet/go-sync/internal/web"
 )
 
@@ -15,6 +16,5 @@ func main() {
 		FS:     fs,
 		Prefix: "frontend/dist",
 	}
-	run.GetRunner().Run()
-	web.StartUp(dist)
+	os.Exit(flag.Execute(os.Args[1:], dist))
 }
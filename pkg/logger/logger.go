@@ -1,14 +1,41 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 )
 
 var Logger *log.Logger
 var multiWriter io.Writer
 
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var level = LevelDebug
+
+func SetLevel(l string) error {
+	switch strings.ToLower(l) {
+	case "debug":
+		level = LevelDebug
+	case "info":
+		level = LevelInfo
+	case "warn", "warning":
+		level = LevelWarn
+	case "error":
+		level = LevelError
+	default:
+		return fmt.Errorf("unknown log level: %s", l)
+	}
+	return nil
+}
+
 func SetLogFile(filePath string) error {
 	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -19,6 +46,13 @@ func SetLogFile(filePath string) error {
 	return nil
 }
 
+// SetOutput replaces the log destination, e.g. os.Stderr when stdout is
+// used for command output.
+func SetOutput(w io.Writer) {
+	multiWriter = w
+	Logger = log.New(w, "INFO", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
 func toInit() {
 	if Logger == nil {
 		Logger = log.New(os.Stdout, "INFO", log.Ldate|log.Ltime|log.Lshortfile)
@@ -26,6 +60,9 @@ func toInit() {
 }
 
 func Info(args ...interface{}) {
+	if level > LevelInfo {
+		return
+	}
 	toInit()
 	Logger.SetPrefix("[INFO ] ")
 	Logger.Println(args...)
@@ -44,12 +81,18 @@ func Fatal(args ...interface{}) {
 }
 
 func Warn(args ...interface{}) {
+	if level > LevelWarn {
+		return
+	}
 	toInit()
 	Logger.SetPrefix("[WARN ] ")
 	Logger.Println(args...)
 }
 
 func Debug(args ...interface{}) {
+	if level > LevelDebug {
+		return
+	}
 	toInit()
 	Logger.SetPrefix("[DEBUG] ")
 	Logger.Println(args...)
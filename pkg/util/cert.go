@@ -0,0 +1,145 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charghet/go-sync/pkg/logger"
+)
+
+// GenerateSelfSigned writes a self-signed certificate valid for the given
+// hosts (names or ips) to certPath and its private key to keyPath.
+func GenerateSelfSigned(certPath, keyPath string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"go-sync"}, CommonName: "go-sync"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err = MkdirForFile(certPath); err != nil {
+		return err
+	}
+	if err = MkdirForFile(keyPath); err != nil {
+		return err
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// CertLoader serves a certificate from disk and reloads it when the
+// certificate or key file is modified.
+type CertLoader struct {
+	CertPath string
+	KeyPath  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func NewCertLoader(certPath, keyPath string) (*CertLoader, error) {
+	l := &CertLoader{CertPath: certPath, KeyPath: keyPath}
+	_, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *CertLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.checked) < 5*time.Second {
+		return l.cert, nil
+	}
+	l.checked = time.Now()
+	mod, err := l.modified()
+	if err != nil || !mod.After(l.modTime) {
+		// keep serving the current certificate if the files are unreadable
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.CertPath, l.KeyPath)
+	if err != nil {
+		logger.Warn("Failed to reload certificate, keep using the old one:", l.CertPath, "Error:", err)
+		l.modTime = mod
+		return l.cert, nil
+	}
+	logger.Info("Reloaded certificate:", l.CertPath)
+	l.cert = &cert
+	l.modTime = mod
+	return l.cert, nil
+}
+
+func (l *CertLoader) load() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	mod, err := l.modified()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(l.CertPath, l.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	l.cert = &cert
+	l.modTime = mod
+	l.checked = time.Now()
+	return l.cert, nil
+}
+
+func (l *CertLoader) modified() (time.Time, error) {
+	ci, err := os.Stat(l.CertPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ki, err := os.Stat(l.KeyPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ki.ModTime().After(ci.ModTime()) {
+		return ki.ModTime(), nil
+	}
+	return ci.ModTime(), nil
+}
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "tls", "cert.pem")
+	key := filepath.Join(dir, "tls", "key.pem")
+	err := GenerateSelfSigned(cert, key, []string{"127.0.0.1", "localhost"})
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	loader, err := NewCertLoader(cert, key)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	c, err := loader.GetCertificate(nil)
+	if err != nil || c == nil {
+		t.Fatalf("Expected a certificate, got %v", err)
+	}
+}
@@ -9,16 +9,17 @@ import (
 
 var secretKey = []byte("go-sync@2025")
 
-func GenerateJWT(username string) (string, error) {
+func GenerateJWT(username string, id string, exp time.Time) (string, error) {
 	claims := jwt.MapClaims{
 		"username": username,
-		"exp":      time.Now().Add(time.Hour * 6).Unix(),
+		"jti":      id,
+		"exp":      exp.Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secretKey)
 }
 
-func ValidateJWT(tokenString string) (string, error) {
+func ValidateJWT(tokenString string) (username string, id string, err error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("无效的签名方法")
@@ -26,18 +27,23 @@ func ValidateJWT(tokenString string) (string, error) {
 		return secretKey, nil
 	})
 	if err != nil || !token.Valid {
-		return "", fmt.Errorf("令牌无效: %v", err)
+		return "", "", fmt.Errorf("令牌无效: %v", err)
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", fmt.Errorf("无法解析claims")
+		return "", "", fmt.Errorf("无法解析claims")
 	}
 
-	username, ok := claims["username"].(string)
+	username, ok = claims["username"].(string)
 	if !ok {
-		return "", fmt.Errorf("用户名无效")
+		return "", "", fmt.Errorf("用户名无效")
 	}
 
-	return username, nil
+	id, ok = claims["jti"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("令牌ID无效")
+	}
+
+	return username, id, nil
 }
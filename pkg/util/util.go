@@ -1,5 +1,11 @@
 package util
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
 func SliceToSet(slice []string) map[string]struct{} {
 	set := make(map[string]struct{}, len(slice))
 	for _, item := range slice {
@@ -7,3 +13,17 @@ func SliceToSet(slice []string) map[string]struct{} {
 	}
 	return set
 }
+
+func RandomHex(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func Sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+const AuthKey = "auth"
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var AllScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Auth describes who made the request, either a login session or an api token.
+type Auth struct {
+	Username string   `json:"username"`
+	Scopes   []string `json:"scopes"`
+	Session  *Session `json:"-"`
+	Token    *Token   `json:"-"`
+}
+
+// Can reports whether the scope is granted. admin implies write and write
+// implies read.
+func (a *Auth) Can(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == ScopeAdmin || s == scope {
+			return true
+		}
+		if s == ScopeWrite && scope == ScopeRead {
+			return true
+		}
+	}
+	return false
+}
+
+func Require(scope string) gin.HandlerFunc {
+	if !slices.Contains(AllScopes, scope) {
+		panic("unknown scope: " + scope)
+	}
+	return func(c *gin.Context) {
+		v, ok := c.Get(AuthKey)
+		if !ok || !v.(*Auth).Can(scope) {
+			panic(ServiceErr{Code: 403, Msg: "permission denied, " + scope + " scope required"})
+		}
+		c.Next()
+	}
+}
@@ -8,6 +8,12 @@ import (
 type BaseController struct {
 }
 
+// SecureCookie marks the login cookie as https only.
+var SecureCookie = false
+
+// ApiPrefix is where the api is mounted, the login cookie is scoped to it.
+var ApiPrefix = "/api"
+
 type Pager struct {
 	Index int `json:"index"`
 	Size  int `json:"size"`
@@ -37,13 +43,39 @@ func (c *BaseController) BindParam(ctx *gin.Context, req interface{}) {
 }
 
 func (c *BaseController) SetLogin(ctx *gin.Context, name string) string {
-	token, _ := util.GenerateJWT(name)
-	ctx.SetCookie("token", token, 21600, "/", "", false, true)
+	session := Sessions.Create(name, ctx.ClientIP(), ctx.Request.UserAgent())
+	token, _ := util.GenerateJWT(name, session.Id, session.Expires)
+	ctx.SetCookie("token", token, int(SessionTTL.Seconds()), ApiPrefix, "", SecureCookie, true)
 	return token
 }
 
+func (c *BaseController) SetLogout(ctx *gin.Context) {
+	if session := c.GetSession(ctx); session != nil {
+		Sessions.Revoke(session.Id)
+	}
+	ctx.SetCookie("token", "", -1, ApiPrefix, "", SecureCookie, true)
+}
+
 func (c *BaseController) GetLogin(ctx *gin.Context) string {
-	token, _ := ctx.Cookie("token")
-	name, _ := util.ValidateJWT(token)
-	return name
+	auth := c.GetAuth(ctx)
+	if auth == nil {
+		return ""
+	}
+	return auth.Username
+}
+
+func (c *BaseController) GetAuth(ctx *gin.Context) *Auth {
+	v, ok := ctx.Get(AuthKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Auth)
+}
+
+func (c *BaseController) GetSession(ctx *gin.Context) *Session {
+	auth := c.GetAuth(ctx)
+	if auth == nil {
+		return nil
+	}
+	return auth.Session
 }
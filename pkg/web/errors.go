@@ -11,6 +11,7 @@ func (e *RecordExistsErr) Error() string {
 type ServiceErr struct {
 	Code int
 	Msg  string
+	Data interface{} // 返回给前端的详细信息
 }
 
 func (e ServiceErr) Error() string {
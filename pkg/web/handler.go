@@ -16,9 +16,11 @@ func ErrorHandler(c *gin.Context) {
 			if err, ok := r.(error); ok {
 				code := 500
 				msg := "internal server error"
+				var data interface{}
 
 				if serr, ok := err.(ServiceErr); ok {
 					msg = serr.Msg
+					data = serr.Data
 					code = 400
 					if serr.Code != 0 {
 						code = serr.Code
@@ -37,6 +39,7 @@ func ErrorHandler(c *gin.Context) {
 				c.JSON(200, &Result{
 					Code: code,
 					Msg:  msg,
+					Data: data,
 				})
 				c.Abort()
 			} else {
@@ -55,13 +58,19 @@ func ErrorHandler(c *gin.Context) {
 }
 
 func CookieHandler(c *gin.Context) {
-	if !strings.HasPrefix(c.Request.URL.Path, "/api/") || c.Request.URL.Path == "/api/login" {
+	if !strings.HasPrefix(c.Request.URL.Path, ApiPrefix+"/") || c.Request.URL.Path == ApiPrefix+"/login" {
 		c.Next()
 		return
 	}
-	token, err := c.Cookie("token")
-	if err == nil {
-		_, err = util.ValidateJWT(token)
+	var auth *Auth
+	var err error
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		auth, err = bearerAuth(bearer)
+	} else if Proxy != nil {
+		auth, err = Proxy.Auth(c)
+	}
+	if auth == nil && err == nil {
+		auth, err = cookieAuth(c)
 	}
 	if err != nil {
 		c.JSON(200, Result{
@@ -72,5 +81,30 @@ func CookieHandler(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	c.Set(AuthKey, auth)
 	c.Next()
 }
+
+func cookieAuth(c *gin.Context) (*Auth, error) {
+	token, err := c.Cookie("token")
+	if err != nil {
+		return nil, err
+	}
+	_, id, err := util.ValidateJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	session, err := Sessions.Check(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Auth{Username: session.Username, Scopes: []string{ScopeAdmin}, Session: session}, nil
+}
+
+func bearerAuth(bearer string) (*Auth, error) {
+	token, err := Tokens.Check(bearer)
+	if err != nil {
+		return nil, err
+	}
+	return &Auth{Username: "token:" + token.Name, Scopes: token.Scopes, Token: token}, nil
+}
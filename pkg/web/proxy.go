@@ -0,0 +1,101 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyAuth trusts the user name set by an authenticating reverse proxy, but
+// only for connections coming from one of the trusted networks.
+type ProxyAuth struct {
+	Header      string
+	Trusted     []*net.IPNet
+	TrustUnix   bool              // 信任 unix socket 连接
+	Roles       map[string]string // 用户名 -> 角色
+	DefaultRole string            // 未配置角色的用户，为空时拒绝
+}
+
+// Proxy is nil when proxy authentication is disabled.
+var Proxy *ProxyAuth
+
+func NewProxyAuth(header string, trusted []string, roles map[string]string, defaultRole string) (*ProxyAuth, error) {
+	if header == "" {
+		return nil, errors.New("proxy auth header is empty")
+	}
+	p := &ProxyAuth{
+		Header:      header,
+		Roles:       roles,
+		DefaultRole: defaultRole,
+	}
+	for _, t := range trusted {
+		if t == "unix" {
+			p.TrustUnix = true
+			continue
+		}
+		if !strings.Contains(t, "/") {
+			if ip := net.ParseIP(t); ip != nil && ip.To4() != nil {
+				t += "/32"
+			} else {
+				t += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", t, err)
+		}
+		p.Trusted = append(p.Trusted, n)
+	}
+	if len(p.Trusted) == 0 && !p.TrustUnix {
+		return nil, errors.New("proxy auth needs at least one trusted proxy")
+	}
+	for user, role := range roles {
+		if !slices.Contains(AllScopes, role) {
+			return nil, fmt.Errorf("unknown role %q for user %q", role, user)
+		}
+	}
+	if defaultRole != "" && !slices.Contains(AllScopes, defaultRole) {
+		return nil, fmt.Errorf("unknown default role %q", defaultRole)
+	}
+	return p, nil
+}
+
+// IsTrusted checks the address of the connection itself, X-Forwarded-For is
+// ignored since it can be set by anyone.
+func (p *ProxyAuth) IsTrusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// unix socket 连接没有 ip 地址
+		return p.TrustUnix
+	}
+	for _, n := range p.Trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Auth returns nil when the request does not carry a trusted proxy user.
+func (p *ProxyAuth) Auth(c *gin.Context) (*Auth, error) {
+	username := strings.TrimSpace(c.GetHeader(p.Header))
+	if username == "" || !p.IsTrusted(c.Request.RemoteAddr) {
+		return nil, nil
+	}
+	role, ok := p.Roles[username]
+	if !ok {
+		role = p.DefaultRole
+	}
+	if role == "" {
+		return nil, fmt.Errorf("proxy user %q has no role", username)
+	}
+	return &Auth{Username: username, Scopes: []string{role}}, nil
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProxyAuth(t *testing.T) {
+	p, err := NewProxyAuth("X-Forwarded-User", []string{"10.0.0.0/8", "127.0.0.1"}, map[string]string{"alice": ScopeAdmin}, "")
+	if err != nil {
+		t.Fatalf("Failed to create proxy auth: %v", err)
+	}
+	cases := []struct {
+		remote string
+		user   string
+		ok     bool
+		err    bool
+	}{
+		{"10.1.2.3:5000", "alice", true, false},
+		{"127.0.0.1:5000", "alice", true, false},
+		{"192.168.1.1:5000", "alice", false, false},
+		{"10.1.2.3:5000", "bob", false, true},
+		{"@", "alice", false, false},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/repos", nil)
+		c.Request.RemoteAddr = tc.remote
+		c.Request.Header.Set("X-Forwarded-User", tc.user)
+		auth, err := p.Auth(c)
+		if (auth != nil) != tc.ok || (err != nil) != tc.err {
+			t.Errorf("%s %s: got auth %v err %v", tc.remote, tc.user, auth, err)
+		}
+		if auth != nil && !auth.Can(ScopeAdmin) {
+			t.Errorf("Expected %s to be admin", tc.user)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charghet/go-sync/pkg/util"
+)
+
+var SessionTTL = 6 * time.Hour
+
+type Session struct {
+	Id        string    `json:"id"`
+	Username  string    `json:"username"`
+	Ip        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Expires   time.Time `json:"expires"`
+	stamp     string
+}
+
+// SessionStore keeps the issued login tokens so that they can be revoked
+// before the JWT itself expires.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// Stamp returns a fingerprint of the user's credentials. Sessions created
+	// under a different stamp are revoked, e.g. after a password change.
+	Stamp func(username string) string
+}
+
+var Sessions = NewSessionStore()
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{sessions: make(map[string]*Session)}
+}
+
+func (s *SessionStore) stamp(username string) string {
+	if s.Stamp == nil {
+		return ""
+	}
+	return s.Stamp(username)
+}
+
+func (s *SessionStore) Create(username, ip, userAgent string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup()
+	now := time.Now()
+	session := &Session{
+		Id:        util.RandomHex(16),
+		Username:  username,
+		Ip:        ip,
+		UserAgent: userAgent,
+		Created:   now,
+		LastSeen:  now,
+		Expires:   now.Add(SessionTTL),
+		stamp:     s.stamp(username),
+	}
+	s.sessions[session.Id] = session
+	return session
+}
+
+func (s *SessionStore) Check(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, errors.New("session not found")
+	}
+	if time.Now().After(session.Expires) {
+		delete(s.sessions, id)
+		return nil, errors.New("session expired")
+	}
+	if session.stamp != s.stamp(session.Username) {
+		delete(s.sessions, id)
+		return nil, errors.New("session revoked, credentials changed")
+	}
+	session.LastSeen = time.Now()
+	return session, nil
+}
+
+func (s *SessionStore) Revoke(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[id]
+	delete(s.sessions, id)
+	return ok
+}
+
+func (s *SessionStore) RevokeUser(username string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, session := range s.sessions {
+		if session.Username == username {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *SessionStore) List() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup()
+	res := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		if session.stamp != s.stamp(session.Username) {
+			continue
+		}
+		res = append(res, *session)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res
+}
+
+func (s *SessionStore) cleanup() {
+	now := time.Now()
+	for id, session := range s.sessions {
+		if now.After(session.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
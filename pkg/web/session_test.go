@@ -0,0 +1,30 @@
+package web
+
+import "testing"
+
+func TestSessionRevoke(t *testing.T) {
+	store := NewSessionStore()
+	password := "admin123"
+	store.Stamp = func(username string) string {
+		return username + ":" + password
+	}
+	s := store.Create("admin", "127.0.0.1", "test")
+	if _, err := store.Check(s.Id); err != nil {
+		t.Fatalf("Expected session to be valid: %v", err)
+	}
+	if !store.Revoke(s.Id) {
+		t.Fatal("Expected session to be revoked")
+	}
+	if _, err := store.Check(s.Id); err == nil {
+		t.Fatal("Expected revoked session to be rejected")
+	}
+
+	s = store.Create("admin", "127.0.0.1", "test")
+	password = "changed"
+	if _, err := store.Check(s.Id); err == nil {
+		t.Fatal("Expected session to be rejected after password change")
+	}
+	if len(store.List()) != 0 {
+		t.Fatal("Expected no active sessions after password change")
+	}
+}
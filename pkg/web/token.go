@@ -0,0 +1,151 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charghet/go-sync/pkg/logger"
+	"github.com/charghet/go-sync/pkg/util"
+)
+
+const TokenPrefix = "gst_"
+
+type Token struct {
+	Id       string     `json:"id"`
+	Name     string     `json:"name"`
+	Hash     string     `json:"hash,omitempty"`
+	Scopes   []string   `json:"scopes"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires"`
+	LastUsed *time.Time `json:"lastUsed"`
+}
+
+// TokenStore holds the long-lived API tokens. Only the sha256 of a token is
+// kept, the plain value is returned once by Create.
+type TokenStore struct {
+	mu     sync.Mutex
+	path   string
+	tokens []*Token
+}
+
+var Tokens = &TokenStore{}
+
+func (s *TokenStore) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.tokens = nil
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &s.tokens)
+}
+
+func (s *TokenStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = util.MkdirForFile(s.path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, b, 0600)
+}
+
+func (s *TokenStore) Create(name string, scopes []string, ttl time.Duration) (string, Token, error) {
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return "", Token{}, errors.New("unknown scope: " + scope)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value := TokenPrefix + util.RandomHex(24)
+	token := &Token{
+		Id:      util.RandomHex(8),
+		Name:    name,
+		Hash:    util.Sha256Hex(value),
+		Scopes:  scopes,
+		Created: time.Now(),
+	}
+	if ttl > 0 {
+		exp := token.Created.Add(ttl)
+		token.Expires = &exp
+	}
+	s.tokens = append(s.tokens, token)
+	err := s.save()
+	if err != nil {
+		s.tokens = s.tokens[:len(s.tokens)-1]
+		return "", Token{}, err
+	}
+	return value, token.public(), nil
+}
+
+func (s *TokenStore) Check(value string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := util.Sha256Hex(value)
+	for _, token := range s.tokens {
+		if token.Hash != hash {
+			continue
+		}
+		now := time.Now()
+		if token.Expires != nil && now.After(*token.Expires) {
+			return nil, errors.New("token expired")
+		}
+		// only persist the last use once in a while, not on every request
+		persist := token.LastUsed == nil || now.Sub(*token.LastUsed) > time.Minute
+		token.LastUsed = &now
+		if persist {
+			if err := s.save(); err != nil {
+				logger.Warn("Failed to save tokens:", err)
+			}
+		}
+		t := token.public()
+		return &t, nil
+	}
+	return nil, errors.New("token not found")
+}
+
+func (s *TokenStore) Revoke(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.tokens, func(t *Token) bool { return t.Id == id })
+	if i < 0 {
+		return false, nil
+	}
+	s.tokens = slices.Delete(s.tokens, i, i+1)
+	return true, s.save()
+}
+
+func (s *TokenStore) List() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]Token, len(s.tokens))
+	for i, token := range s.tokens {
+		res[i] = token.public()
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res
+}
+
+func (t *Token) public() Token {
+	res := *t
+	res.Hash = ""
+	return res
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "tokens.json")
+	store := &TokenStore{}
+	if err := store.Load(p); err != nil {
+		t.Fatalf("Failed to load token store: %v", err)
+	}
+	value, token, err := store.Create("ci", []string{ScopeRead}, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if token.Hash != "" {
+		t.Error("Expected token hash to be hidden")
+	}
+
+	reloaded := &TokenStore{}
+	if err := reloaded.Load(p); err != nil {
+		t.Fatalf("Failed to reload token store: %v", err)
+	}
+	checked, err := reloaded.Check(value)
+	if err != nil {
+		t.Fatalf("Expected token to be valid: %v", err)
+	}
+	auth := Auth{Scopes: checked.Scopes}
+	if !auth.Can(ScopeRead) || auth.Can(ScopeWrite) {
+		t.Errorf("Unexpected scopes: %v", checked.Scopes)
+	}
+
+	if ok, err := reloaded.Revoke(token.Id); !ok || err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := reloaded.Check(value); err == nil {
+		t.Error("Expected revoked token to be rejected")
+	}
+	if _, _, err := store.Create("bad", []string{"root"}, 0); err == nil {
+		t.Error("Expected unknown scope to be rejected")
+	}
+}